@@ -0,0 +1,220 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// tarMagic is the magic of POSIX and GNU tar headers, at tarMagicOffset.
+var tarMagic = []byte("ustar")
+
+const tarMagicOffset = 257
+
+// archiveSeparator separates the name of a tar archive and of an entry in it
+// in the name of an input, as in logs.tar/app/app.log, so that the entry has
+// its own base name.
+const archiveSeparator = "/"
+
+// sniffTar reports whether the decompressed input dr is a tar archive. It
+// returns a reader of dr that still holds the sniffed bytes.
+func sniffTar(dr io.ReadCloser) (io.ReadCloser, bool) {
+	br := bufio.NewReader(dr)
+	magic, _ := br.Peek(tarMagicOffset + len(tarMagic))
+	rc := struct {
+		io.Reader
+		io.Closer
+	}{br, dr}
+	return rc, len(magic) == tarMagicOffset+len(tarMagic) && bytes.Equal(magic[tarMagicOffset:], tarMagic)
+}
+
+// tarEntry is a regular file extracted from a tar archive.
+type tarEntry struct {
+	name    string
+	modTime time.Time
+	size    int64
+	path    string // a temporary copy of the entry
+}
+
+// extractTar copies the regular files of the tar archive r into temporary
+// files, which the caller removes. On an error, the copies made so far are
+// removed.
+func extractTar(r io.Reader) (entries []tarEntry, err error) {
+	defer func() {
+		if err != nil {
+			for _, e := range entries {
+				_ = os.Remove(e.path)
+			}
+			entries = nil
+		}
+	}()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		path, err := copyToTemp(tr)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, tarEntry{name: hdr.Name, modTime: hdr.ModTime, size: hdr.Size, path: path})
+	}
+}
+
+// copyToTemp copies r into a new temporary file and returns its path.
+func copyToTemp(r io.Reader) (string, error) {
+	f, err := os.CreateTemp("", "logmerge-tar-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// archiveEntries are the entries of the tar archives among the arguments,
+// extracted by expandArchives. A nil *archiveEntries has none.
+type archiveEntries struct {
+	// by names like logs.tar/app/app.log; an archive given twice has two
+	// copies of each entry, take returns the first one left
+	byName map[string][]tarEntry
+	paths  []string // all temporary copies
+}
+
+// take returns the first copy left of the entry name, which the caller
+// removes once it is done with it.
+func (a *archiveEntries) take(name string) (tarEntry, bool) {
+	if a == nil || len(a.byName[name]) == 0 {
+		return tarEntry{}, false
+	}
+	e := a.byName[name][0]
+	a.byName[name] = a.byName[name][1:]
+	return e, true
+}
+
+// path returns the path of the next copy of the entry name, or name itself
+// if it is not an entry.
+func (a *archiveEntries) path(name string) string {
+	if a == nil || len(a.byName[name]) == 0 {
+		return name
+	}
+	return a.byName[name][0].path
+}
+
+// size returns the size of the entry name in its archive, if it is one.
+func (a *archiveEntries) size(name string) (int64, bool) {
+	if a == nil || len(a.byName[name]) == 0 {
+		return 0, false
+	}
+	return a.byName[name][0].size, true
+}
+
+// Remove removes all copies, also those taken and not removed yet, e.g. on
+// an exit before the inputs are closed.
+func (a *archiveEntries) Remove() {
+	if a == nil {
+		return
+	}
+	for _, path := range a.paths {
+		_ = os.Remove(path)
+	}
+	a.paths = nil
+}
+
+// tarSuffixes are the file name extensions of tar archives, also compressed.
+var tarSuffixes = []string{".tar", ".tar.gz", ".tgz", ".tar.zst", ".tzst", ".tar.bz2", ".tbz2", ".tbz"}
+
+// isTarName reports whether file is named like a tar archive.
+func isTarName(file string) bool {
+	for _, suffix := range tarSuffixes {
+		if strings.HasSuffix(file, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandArchives replaces the tar archives among files by the regular files
+// in them, extracted to temporary files, so that each of them counts as a
+// file for -max-open. Only files named like archives are opened to check;
+// openInputs extracts an archive under another name or fetched from a URL
+// itself. It returns the extracted entries, which the caller removes, and
+// the number of archives that could not be read.
+func expandArchives(files []string) ([]string, *archiveEntries, int) {
+	expanded := make([]string, 0, len(files))
+	archives := &archiveEntries{byName: map[string][]tarEntry{}}
+	failed := 0
+	for _, file := range files {
+		if file == stdinArg || isURL(file) || !isTarName(file) {
+			expanded = append(expanded, file)
+			continue
+		}
+		entries, isTar, err := readArchive(file)
+		switch {
+		case err != nil:
+			logFileErrorf("Error reading archive %s: %s\n", file, err)
+			failed++
+		case isTar:
+			for _, e := range entries {
+				name := file + archiveSeparator + e.name
+				archives.byName[name] = append(archives.byName[name], e)
+				archives.paths = append(archives.paths, e.path)
+				expanded = append(expanded, name)
+			}
+		default:
+			expanded = append(expanded, file)
+		}
+	}
+	return expanded, archives, failed
+}
+
+// readArchive extracts the regular files of file if it is a tar archive,
+// possibly compressed. Errors opening or decompressing file are left to
+// openInputs to report. Other than regular files, such as named pipes, are
+// not read, as what is read of them would be missing from the merge.
+func readArchive(file string) (entries []tarEntry, isTar bool, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, false, nil
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err != nil || !fi.Mode().IsRegular() {
+		return nil, false, nil
+	}
+	dr, _, err := decompressReader(f)
+	if err != nil {
+		return nil, false, nil
+	}
+	defer dr.Close()
+	r, isTar := sniffTar(dr)
+	if !isTar {
+		return nil, false, nil
+	}
+	entries, err = extractTar(r)
+	return entries, true, err
+}
+
+// removeFile is an io.Closer that removes a temporary file.
+type removeFile string
+
+func (f removeFile) Close() error {
+	return os.Remove(string(f))
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/100days/logmerge"
+)
+
+// writeTarGz writes a gzip-compressed tar archive of the files, name and
+// content in turn, to path.
+func writeTarGz(t *testing.T, path string, modTime time.Time, files ...string) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "app/", Mode: 0o755, ModTime: modTime}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(files); i += 2 {
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: files[i], Mode: 0o644, Size: int64(len(files[i+1])), ModTime: modTime}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(files[i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mergeInputs merges in and returns the messages of the lines.
+func mergeInputs(in *inputs) (string, error) {
+	lines, err := logmerge.MergeSources(context.Background(), in.sources(), logmerge.Options{ModTimes: in.modTimes})
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for line := range lines {
+		b.WriteString(line.Message() + "\n")
+	}
+	return b.String(), nil
+}
+
+func TestExpandArchives(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Date(2025, time.June, 11, 0, 0, 0, 0, time.UTC)
+	archive := filepath.Join(dir, "logs.tar.gz")
+	writeTarGz(t, archive, modTime,
+		"app/a.log", "Jun 10 14:30:00 a\n",
+		"app/b.log", "2025-06-10 14:30:01 b\n",
+		"c.log", "2025-06-10 14:30:02 c\n")
+	plain := filepath.Join(dir, "plain.log")
+	if err := os.WriteFile(plain, []byte("2025-06-10 14:30:03 plain\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.log")
+	// not named like an archive, so left to openInputs
+	renamed := filepath.Join(dir, "logs.bin")
+	writeTarGz(t, renamed, modTime, "d.log", "2025-06-10 14:30:04 d\n")
+
+	files, archives, failed := expandArchives([]string{plain, archive, stdinArg, missing, renamed})
+	defer archives.Remove()
+	want := []string{plain, archive + "/app/a.log", archive + "/app/b.log", archive + "/c.log", stdinArg, missing, renamed}
+	if !slices.Equal(files, want) || failed != 0 {
+		t.Fatalf("got %q, %d failed, want %q", files, failed, want)
+	}
+	copies := slices.Clone(archives.paths)
+	if len(copies) != 3 {
+		t.Fatalf("got copies %q, want 3", copies)
+	}
+
+	opened := []string{plain, archive + "/app/a.log", archive + "/app/b.log", archive + "/c.log", renamed + "/d.log"}
+	in := openInputs(context.Background(), append(files[:4:4], renamed), archives, false)
+	if !slices.Equal(in.names, opened) {
+		t.Errorf("opened %q", in.names)
+	}
+	for i, got := range in.modTimes[1:] {
+		if !got.Equal(modTime) {
+			t.Errorf("%s: modification time %s, want %s", in.names[i+1], got, modTime)
+		}
+	}
+	lines, err := mergeInputs(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a\nb\nc\nplain\nd\n"; lines != want {
+		t.Errorf("merged %q, want %q", lines, want)
+	}
+	in.Close()
+	for _, path := range copies {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s: not removed: %v", path, err)
+		}
+	}
+}
+
+func TestExpandArchivesTwice(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "logs.tar.gz")
+	writeTarGz(t, archive, time.Time{}, "a.log", "2025-06-10 14:30:00 a\n")
+	files, archives, _ := expandArchives([]string{archive, archive})
+	defer archives.Remove()
+	for _, file := range files {
+		in := openInputs(context.Background(), []string{file}, archives, false)
+		if lines, err := mergeInputs(in); err != nil || !strings.HasSuffix(lines, "a\n") {
+			t.Errorf("%s: merged %q, %v", file, lines, err)
+		}
+		in.Close()
+	}
+}
+
+func TestDryRunArchiveSizes(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "logs.tar.gz")
+	writeTarGz(t, archive, time.Time{}, "a.log", "2025-06-10 14:30:00 a\n", "b.log", "2025-06-10 14:30:01 bb\n")
+	renamed := filepath.Join(dir, "logs.bin")
+	writeTarGz(t, renamed, time.Time{}, "c.log", "2025-06-10 14:30:02 c\n")
+	files, archives, _ := expandArchives([]string{archive, renamed})
+	defer archives.Remove()
+
+	var b bytes.Buffer
+	if problems := dryRun(context.Background(), &b, files, archives, logmerge.Options{}, nil, false); problems != 0 {
+		t.Errorf("%d problems", problems)
+	}
+	sizes := map[string]string{}
+	for _, row := range strings.Split(strings.TrimSpace(b.String()), "\n")[1:] {
+		fields := strings.Fields(row)
+		sizes[fields[0]] = fields[1]
+	}
+	want := map[string]string{
+		archive + "/a.log": "22",
+		archive + "/b.log": "23",
+		// found by its content, not its name
+		renamed + "/c.log": "-",
+	}
+	if !maps.Equal(sizes, want) {
+		t.Errorf("got sizes %v, want %v", sizes, want)
+	}
+}
+
+func TestArchiveCopiesRemovedOnExit(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "logs.tar.gz")
+	writeTarGz(t, archive, time.Time{}, "a.log", "2025-06-10 14:30:00 a\n", "b.log", "2025-06-10 14:30:01 b\n")
+	renamed := filepath.Join(dir, "logs.bin")
+	writeTarGz(t, renamed, time.Time{}, "c.log", "2025-06-10 14:30:02 c\n")
+	missing := filepath.Join(dir, "missing.log")
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"merged", []string{archive, renamed}},
+		{"head", []string{"-head", "1", archive, renamed}},
+		{"strict", []string{"-strict", archive, renamed, missing}},
+		{"out", []string{"-out", filepath.Join(dir, "missing", "out.log"), archive, renamed}},
+		{"format", []string{"-format", "xml", archive, renamed}},
+		{"max-open", []string{"-max-open", "1", archive, renamed}},
+		{"summary", []string{"-summary", archive, renamed}},
+		{"dry-run", []string{"-dry-run", archive, renamed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			cmd := logmergeCmd(t, tt.args...)
+			cmd.Env = append(cmd.Env, "TMPDIR="+tmp)
+			_ = cmd.Run()
+			left, err := os.ReadDir(tmp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range left {
+				t.Errorf("left %s", e.Name())
+			}
+		})
+	}
+}
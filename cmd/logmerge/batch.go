@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/100days/logmerge"
+)
+
+// premerged holds the inputs when there are more than -max-open of them.
+// They are merged in batches of at most maxOpen files into temporary files,
+// which are merged in turn until at most maxOpen remain. Every line is thus
+// written to and read from disk once per round, in exchange for never having
+// more than maxOpen+1 files open.
+type premerged struct {
+	dir    string   // temporary directory of the batch files
+	files  []string // batch files, in the order of their inputs
+	names  []string // the inputs that could be opened
+	stats  logmerge.Stats
+	failed int     // files that could not be opened
+	errs   []error // per batch file, the error reading it back
+
+	location *time.Location // -tz
+	fileTZ   fileTimezones
+}
+
+// premerge merges allFiles, the entries of archives among them, in batches of
+// maxOpen files with opts and the timezones of fileTZ, see premerged. It
+// returns ctx.Err() if ctx is cancelled meanwhile.
+func premerge(ctx context.Context, allFiles []string, archives *archiveEntries, maxOpen int, opts logmerge.Options, fileTZ fileTimezones) (*premerged, error) {
+	dir, err := os.MkdirTemp("", "logmerge-")
+	if err != nil {
+		return nil, err
+	}
+	p := &premerged{dir: dir, location: opts.Location, fileTZ: fileTZ}
+	for start := 0; start < len(allFiles); start += maxOpen {
+		in := openInputs(ctx, allFiles[start:min(start+maxOpen, len(allFiles))], archives, false)
+		p.failed += in.failed
+		var stats logmerge.Stats
+		batchOpts := opts
+		batchOpts.ModTimes, batchOpts.Stats = in.modTimes, &stats
+		batchOpts.Locations = fileTZ.locations(in.names)
+		lines, err := logmerge.MergeSources(ctx, in.sources(), batchOpts)
+		if err == nil {
+			err = p.spill(lines)
+		}
+		in.Close()
+		p.stats.Lines += stats.Lines
+		p.stats.CacheHits += stats.CacheHits
+		p.stats.CacheMisses += stats.CacheMisses
+		p.stats.Errors = append(p.stats.Errors, stats.Errors...)
+		p.stats.Files = append(p.stats.Files, stats.Files...)
+		p.names = append(p.names, in.names...)
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+
+	for len(p.files) > maxOpen {
+		var files []string
+		files, p.files = p.files, nil
+		for start := 0; start < len(files); start += maxOpen {
+			batch := files[start:min(start+maxOpen, len(files))]
+			err := p.spill(p.mergeFiles(ctx, batch))
+			for _, file := range batch {
+				_ = os.Remove(file)
+			}
+			if err == nil {
+				err = p.Err()
+			}
+			if err == nil {
+				err = ctx.Err()
+			}
+			if err != nil {
+				p.Close()
+				return nil, err
+			}
+		}
+	}
+	return p, nil
+}
+
+// spill writes lines to a new batch file.
+func (p *premerged) spill(lines <-chan logmerge.Line) error {
+	f, err := os.CreateTemp(p.dir, "batch-*.gob")
+	if err != nil {
+		for range lines {
+		}
+		return err
+	}
+	p.files = append(p.files, f.Name())
+	w := bufio.NewWriter(f)
+	enc := gob.NewEncoder(w)
+	for line := range lines {
+		if err == nil {
+			err = enc.Encode(line)
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// mergeFiles merges the lines of the batch files.
+func (p *premerged) mergeFiles(ctx context.Context, files []string) <-chan logmerge.Line {
+	p.errs = make([]error, len(files))
+	streams := make([]<-chan logmerge.Line, len(files))
+	for i, file := range files {
+		streams[i] = readBatch(ctx, file, p.locationOf, &p.errs[i])
+	}
+	return logmerge.MergeLines(ctx, streams)
+}
+
+// Merge returns the merged lines of all batch files.
+func (p *premerged) Merge(ctx context.Context) <-chan logmerge.Line {
+	return p.mergeFiles(ctx, p.files)
+}
+
+// locationOf returns the timezone the timestamps of file were parsed in.
+func (p *premerged) locationOf(file string) *time.Location {
+	if location := p.fileTZ.location(file); location != nil {
+		return location
+	}
+	return p.location
+}
+
+// Err returns the first error reading back the batch files of the last
+// merge, once its channel is closed. It returns nil on a nil premerged.
+func (p *premerged) Err() error {
+	if p == nil {
+		return nil
+	}
+	for _, err := range p.errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close removes the batch files. It does nothing on a nil premerged.
+func (p *premerged) Close() {
+	if p == nil {
+		return
+	}
+	_ = os.RemoveAll(p.dir)
+}
+
+// readBatch sends the lines of a batch file on the returned channel, which is
+// closed at the end of the file or when ctx is cancelled. The timestamps get
+// the timezone locationOf their input file, an error reading the file is
+// stored in errp.
+func readBatch(ctx context.Context, file string, locationOf func(string) *time.Location, errp *error) <-chan logmerge.Line {
+	ch := make(chan logmerge.Line)
+	go func() {
+		defer close(ch)
+		f, err := os.Open(file)
+		if err != nil {
+			*errp = err
+			return
+		}
+		defer f.Close()
+		dec := gob.NewDecoder(bufio.NewReader(f))
+		for {
+			var line logmerge.Line
+			if err := dec.Decode(&line); err != nil {
+				if err != io.EOF {
+					*errp = fmt.Errorf("%s: %w", filepath.Base(file), err)
+				}
+				return
+			}
+			line.Timestamp = restoreLocation(line.Timestamp, locationOf(line.Filename))
+			select {
+			case ch <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// restoreLocation returns t in location if it has the same offset there. Gob
+// only keeps the offset of a time, which loses the zone name for -outfmt.
+func restoreLocation(t time.Time, location *time.Location) time.Time {
+	if location == nil {
+		return t
+	}
+	_, offset := t.Zone()
+	if _, locationOffset := t.In(location).Zone(); offset == locationOffset {
+		return t.In(location)
+	}
+	return t
+}
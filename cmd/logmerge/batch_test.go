@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/100days/logmerge"
+)
+
+// formatLines returns lines with all fields that the output may show.
+func formatLines(lines <-chan logmerge.Line) string {
+	var sb strings.Builder
+	for line := range lines {
+		fmt.Fprintf(&sb, "%s %s %d %s\n", line.Timestamp.Format(time.RFC3339Nano), filepath.Base(line.Filename), line.LineNo, line.OriginalLine())
+	}
+	return sb.String()
+}
+
+func TestPremerge(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for i := 0; i < 7; i++ {
+		var sb strings.Builder
+		for j := 0; j < 20; j++ {
+			// every second of lines is in several files, and some lines
+			// of a file share it too
+			fmt.Fprintf(&sb, "2025-06-10 14:30:%02d.%03d file %d line %d\n", (j+i%3)/2, 500*(i%2), i, j)
+			if j%5 == 0 {
+				fmt.Fprintf(&sb, "  continued %d\n", j)
+			}
+		}
+		file := filepath.Join(dir, fmt.Sprintf("%d.log", i))
+		if err := os.WriteFile(file, []byte(sb.String()), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	ctx := context.Background()
+
+	in := openInputs(ctx, files, nil, false)
+	lines, err := logmerge.MergeSources(ctx, in.sources(), logmerge.Options{ModTimes: in.modTimes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := formatLines(lines)
+	in.Close()
+
+	for _, maxOpen := range []int{2, 3, 6} {
+		t.Run(fmt.Sprint(maxOpen), func(t *testing.T) {
+			p, err := premerge(ctx, files, nil, maxOpen, logmerge.Options{}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+			if len(p.files) > maxOpen {
+				t.Errorf("%d batch files left", len(p.files))
+			}
+			got := formatLines(p.Merge(ctx))
+			if err := p.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+			if p.stats.Lines != 7*24 {
+				t.Errorf("%d lines read, want %d", p.stats.Lines, 7*24)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// colorMode is the value of the -color flag: always, never or auto color the
+// filename column, level colors whole lines by their level on a terminal.
+type colorMode string
+
+const (
+	colorAlways colorMode = "always"
+	colorNever  colorMode = "never"
+	colorAuto   colorMode = "auto"
+	colorLevel  colorMode = "level"
+)
+
+func (c *colorMode) String() string { return string(*c) }
+
+func (c *colorMode) Set(value string) error {
+	switch colorMode(value) {
+	case colorAlways, colorNever, colorAuto, colorLevel:
+		*c = colorMode(value)
+	default:
+		return fmt.Errorf("must be always, never, auto or level")
+	}
+	return nil
+}
+
+// enabled reports whether output to f should be colored. always and never
+// are explicit; auto and level color a terminal, unless NO_COLOR is set, or
+// anything if CLICOLOR_FORCE is set and not 0.
+func (c colorMode) enabled(f *os.File) bool {
+	switch c {
+	case colorAlways:
+		return true
+	case colorAuto, colorLevel:
+		// https://no-color.org and https://bixense.com/clicolors
+		if os.Getenv("NO_COLOR") != "" {
+			return false
+		}
+		if force := os.Getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+			return true
+		}
+		return isTerminal(f)
+	}
+	return false
+}
+
+// isTerminal reports whether f is a character device, i.e. a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// filePalette holds the ANSI foreground colors assigned to input files.
+var filePalette = []int{31, 32, 33, 34, 35, 36, 91, 92, 93, 94, 95, 96}
+
+// fileColor returns the ANSI color of filename, which is stable across runs.
+func fileColor(filename string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(filename))
+	return filePalette[h.Sum32()%uint32(len(filePalette))]
+}
+
+// colorize wraps s in the escape sequences for the ANSI color.
+func colorize(s string, color int) string {
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, s)
+}
+
+// levelColorsEnv overrides entries of defaultLevelColors, e.g.
+// LOGMERGE_LEVEL_COLORS="error=95,warn=36" for colorblind users.
+const levelColorsEnv = "LOGMERGE_LEVEL_COLORS"
+
+// defaultLevelColors are the ANSI foreground colors of -color=level. Lines
+// without a color are not colored.
+var defaultLevelColors = map[level]int{
+	levelDebug: 90, // grey
+	levelWarn:  33, // yellow
+	levelError: 31, // red
+	levelFatal: 91, // bright red
+}
+
+// levelColors returns defaultLevelColors with the overrides of spec, a comma
+// separated list of level=color with ANSI color numbers, 0 for no color.
+func levelColors(spec string) (map[level]int, error) {
+	colors := make(map[level]int, len(defaultLevelColors))
+	for l, color := range defaultLevelColors {
+		colors[l] = color
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, value, found := strings.Cut(entry, "=")
+		l, err := parseLevel(strings.TrimSpace(name))
+		if !found || err != nil {
+			return nil, fmt.Errorf("%s: expected level=color, got %q", levelColorsEnv, entry)
+		}
+		color, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || color < 0 {
+			return nil, fmt.Errorf("%s: invalid color %q for %s", levelColorsEnv, value, name)
+		}
+		colors[l] = color
+	}
+	return colors, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestColorEnabled(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	// a character device like a terminal
+	device, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer device.Close()
+
+	tests := []struct {
+		mode               colorMode
+		noColor, force     string
+		toFile, toTerminal bool
+	}{
+		{colorAuto, "", "", false, true},
+		{colorLevel, "", "", false, true},
+		{colorAuto, "1", "", false, false},
+		{colorLevel, "1", "", false, false},
+		{colorAuto, "", "1", true, true},
+		{colorAuto, "", "0", false, true},
+		{colorAuto, "1", "1", false, false},
+		{colorAlways, "1", "", true, true},
+		{colorNever, "", "1", false, false},
+	}
+	for _, tt := range tests {
+		t.Setenv("NO_COLOR", tt.noColor)
+		t.Setenv("CLICOLOR_FORCE", tt.force)
+		if got := tt.mode.enabled(file); got != tt.toFile {
+			t.Errorf("%s, NO_COLOR=%q, CLICOLOR_FORCE=%q: file colored %v, want %v", tt.mode, tt.noColor, tt.force, got, tt.toFile)
+		}
+		if got := tt.mode.enabled(device); got != tt.toTerminal {
+			t.Errorf("%s, NO_COLOR=%q, CLICOLOR_FORCE=%q: terminal colored %v, want %v", tt.mode, tt.noColor, tt.force, got, tt.toTerminal)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/100days/logmerge"
+)
+
+// dryRunLines is how many lines -dry-run reads of a file without timestamp,
+// unless -require-timestamps is given.
+const dryRunLines = 1000
+
+// dryRun prints a table of allFiles, the entries of archives among them, for
+// -dry-run to w: size, compression, and the layout and first timestamp
+// detected, with verbose also the pattern and the line it matched. It opens
+// one file at a time and returns how many files could not be opened or have
+// no timestamp.
+func dryRun(ctx context.Context, w io.Writer, allFiles []string, archives *archiveEntries, opts logmerge.Options, fileTZ fileTimezones, verbose bool) int {
+	if opts.RequireTimestamps == 0 {
+		opts.RequireTimestamps = dryRunLines
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := "File\tSize\tCompression\tLayout\tFirst"
+	if verbose {
+		header += "\tPattern\tLine"
+	}
+	_, _ = fmt.Fprintln(tw, header)
+	problems := 0
+	for _, file := range allFiles {
+		size := "-"
+		if n, ok := archives.size(file); ok {
+			size = strconv.FormatInt(n, 10)
+		} else if fi, err := os.Stat(file); err == nil && file != stdinArg {
+			size = strconv.FormatInt(fi.Size(), 10)
+		}
+		in := openInputs(ctx, []string{file}, archives, false)
+		if len(in.readers) == 0 {
+			in.Close()
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t-\terror: cannot be opened\t-\n", file, size)
+			problems++
+			continue
+		}
+		fileOpts := opts
+		// a tar archive has an input per file in it
+		for i, r := range in.readers {
+			size := size
+			if in.names[i] != file {
+				// of an archive not named like one, whose size is not its entry's
+				size = "-"
+			}
+			fileOpts.Names, fileOpts.ModTimes = in.names[i:i+1], in.modTimes[i:i+1]
+			fileOpts.Locations = fileTZ.locations(fileOpts.Names)
+			line, pattern, err := logmerge.Detect(r, fileOpts)
+			compression := in.compressions[i]
+			if compression == "" {
+				compression = "none"
+			}
+			if err != nil {
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\terror: %v\t-\n", in.names[i], size, compression, err)
+				problems++
+				continue
+			}
+			layout, regex := pattern.Layout, ""
+			if pattern.Regex != nil {
+				regex = pattern.Regex.String()
+			} else {
+				layout = "(parser)"
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s", in.names[i], size, compression, layout, line.Timestamp.Format(time.RFC3339Nano))
+			if verbose {
+				_, _ = fmt.Fprintf(tw, "\t%s\t%q", regex, line.OriginalLine())
+			}
+			_, _ = fmt.Fprintln(tw)
+		}
+		in.Close()
+	}
+	_ = tw.Flush()
+	return problems
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileArg is a file argument: a glob pattern or stdinArg, or with literal a
+// path that is used as is.
+type fileArg struct {
+	name    string
+	literal bool
+}
+
+// expandFileLists replaces each @file argument of args by the entries of
+// file. By default these are one path or glob per line, ignoring blank lines
+// and lines starting with #. With nullSeparated they are NUL-terminated paths
+// as written by find -print0, used literally.
+func expandFileLists(args []string, nullSeparated bool) ([]fileArg, error) {
+	var expanded []fileArg
+	for _, arg := range args {
+		listFile, isList := strings.CutPrefix(arg, "@")
+		if !isList {
+			expanded = append(expanded, fileArg{name: arg})
+			continue
+		}
+		entries, err := readFileList(listFile, nullSeparated)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, entries...)
+	}
+	return expanded, nil
+}
+
+// readFileList reads the entries of a file list, see expandFileLists.
+func readFileList(listFile string, nullSeparated bool) ([]fileArg, error) {
+	f, err := os.Open(listFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []fileArg
+	scanner := bufio.NewScanner(f)
+	if nullSeparated {
+		scanner.Split(scanNull)
+	}
+	for scanner.Scan() {
+		entry := scanner.Text()
+		if nullSeparated {
+			if entry != "" {
+				entries = append(entries, fileArg{name: entry, literal: true})
+			}
+			continue
+		}
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		entries = append(entries, fileArg{name: entry})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", listFile, err)
+	}
+	return entries, nil
+}
+
+// scanNull is a bufio.SplitFunc for NUL-terminated entries.
+func scanNull(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// uniqueFiles returns files without those that resolve to the same file as
+// an earlier one, following symlinks, and the number of files dropped.
+func uniqueFiles(files []string) ([]string, int) {
+	seen := make(map[string]bool, len(files))
+	unique := files[:0:0]
+	for _, file := range files {
+		key := file
+		if file != stdinArg && !isURL(file) {
+			if resolved, err := filepath.EvalSymlinks(file); err == nil {
+				key = resolved
+			}
+			if abs, err := filepath.Abs(key); err == nil {
+				key = abs
+			}
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, file)
+	}
+	return unique, len(files) - len(unique)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestUniqueFiles(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")
+	for _, file := range []string{a, b} {
+		if err := os.WriteFile(file, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(dir, "link.log")
+	if err := os.Symlink(a, link); err != nil {
+		t.Fatal(err)
+	}
+	dotted := filepath.Join(dir, ".", "sub", "..", "a.log")
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	url := "https://example.com/app.log"
+
+	tests := []struct {
+		files, want []string
+	}{
+		{[]string{a, b}, []string{a, b}},
+		{[]string{a, b, a}, []string{a, b}},
+		{[]string{a, link, dotted, b}, []string{a, b}},
+		{[]string{link, a}, []string{link}},
+		{[]string{stdinArg, a, stdinArg}, []string{stdinArg, a}},
+		{[]string{url, url}, []string{url}},
+		{[]string{a, filepath.Join(dir, "missing.log"), filepath.Join(dir, "missing.log")}, []string{a, filepath.Join(dir, "missing.log")}},
+	}
+	for _, tt := range tests {
+		got, dropped := uniqueFiles(tt.files)
+		if !slices.Equal(got, tt.want) || dropped != len(tt.files)-len(tt.want) {
+			t.Errorf("%q: got %q, %d dropped, want %q", tt.files, got, dropped, tt.want)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"hash/maphash"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/100days/logmerge"
+)
+
+// regexpList is a repeatable flag of regular expressions.
+type regexpList []*regexp.Regexp
+
+func (r *regexpList) String() string {
+	exprs := make([]string, len(*r))
+	for i, re := range *r {
+		exprs[i] = re.String()
+	}
+	return strings.Join(exprs, ", ")
+}
+
+func (r *regexpList) Set(value string) error {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	*r = append(*r, re)
+	return nil
+}
+
+// globList is a repeatable flag of glob patterns, matched like the
+// patterns of -file-tz.
+type globList []string
+
+func (g *globList) String() string { return strings.Join(*g, ", ") }
+
+func (g *globList) Set(value string) error {
+	if _, err := filepath.Match(value, ""); err != nil {
+		return err
+	}
+	*g = append(*g, value)
+	return nil
+}
+
+// matchFile reports whether file matches pattern: the whole path if the
+// pattern has a path separator, otherwise the base name.
+func matchFile(pattern, file string) bool {
+	name := baseName(file)
+	if strings.ContainsRune(pattern, '/') {
+		name = file
+	}
+	matched, _ := filepath.Match(pattern, name)
+	return matched
+}
+
+// filter returns files without those matching any of the patterns, and the
+// number of files dropped.
+func (g globList) filter(files []string) ([]string, int) {
+	kept := files[:0:0]
+	for _, file := range files {
+		if file == stdinArg || !slices.ContainsFunc(g, func(pattern string) bool { return matchFile(pattern, file) }) {
+			kept = append(kept, file)
+		}
+	}
+	return kept, len(files) - len(kept)
+}
+
+// fileDateSpan is the time the lines of a file cover from the date in its
+// name, for -fname-date.
+const fileDateSpan = 24 * time.Hour
+
+// fileDate reads the date in the path of a file for -fname-date: the group
+// named ts of re, or else its first group or its whole match, parsed with
+// layout in location.
+type fileDate struct {
+	re       *regexp.Regexp
+	layout   string
+	location *time.Location
+}
+
+// date returns the date in the path of file, if it has one.
+func (d fileDate) date(file string) (time.Time, bool) {
+	m := d.re.FindStringSubmatch(file)
+	if m == nil {
+		return time.Time{}, false
+	}
+	value := m[0]
+	if i := d.re.SubexpIndex("ts"); i >= 0 {
+		value = m[i]
+	} else if len(m) > 1 {
+		value = m[1]
+	}
+	date, err := time.ParseInLocation(d.layout, value, d.location)
+	return date, err == nil
+}
+
+// filter returns files without those whose lines cannot lie within start and
+// end: those dated after end, or fileDateSpan or more before start. Files
+// without date are kept.
+func (d fileDate) filter(files []string, start, end time.Time) (kept, skipped []string) {
+	for _, file := range files {
+		date, found := d.date(file)
+		if file != stdinArg && found &&
+			(!end.IsZero() && date.After(end) || !start.IsZero() && !date.Add(fileDateSpan).After(start)) {
+			skipped = append(skipped, file)
+			continue
+		}
+		kept = append(kept, file)
+	}
+	return kept, skipped
+}
+
+// fileTimezone assigns a timezone to the files matching a glob pattern.
+type fileTimezone struct {
+	pattern  string
+	location *time.Location
+}
+
+// fileTimezones is the repeatable -file-tz flag of "glob=Zone" rules.
+type fileTimezones []fileTimezone
+
+func (f *fileTimezones) String() string {
+	rules := make([]string, len(*f))
+	for i, rule := range *f {
+		rules[i] = rule.pattern + "=" + rule.location.String()
+	}
+	return strings.Join(rules, ", ")
+}
+
+func (f *fileTimezones) Set(value string) error {
+	pattern, zone, found := strings.Cut(value, "=")
+	if !found || pattern == "" || zone == "" {
+		return fmt.Errorf("expected glob=Zone, e.g. \"eu-*.log=Europe/Berlin\"")
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return err
+	}
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, fileTimezone{pattern: pattern, location: location})
+	return nil
+}
+
+// location returns the timezone of the first rule matching file, or nil.
+// Patterns with a path separator match the whole path, others the base name.
+func (f fileTimezones) location(file string) *time.Location {
+	for _, rule := range f {
+		if matchFile(rule.pattern, file) {
+			return rule.location
+		}
+	}
+	return nil
+}
+
+// zoneAbbreviations is the repeatable -tz-abbr flag of "ABBR=offset" rules,
+// for logmerge.Options.ZoneAbbreviations.
+type zoneAbbreviations map[string]*time.Location
+
+func (z *zoneAbbreviations) String() string {
+	rules := make([]string, 0, len(*z))
+	for name, zone := range *z {
+		rules = append(rules, name+"="+time.Time{}.In(zone).Format("-07:00"))
+	}
+	slices.Sort(rules)
+	return strings.Join(rules, ", ")
+}
+
+func (z *zoneAbbreviations) Set(value string) error {
+	name, offset, found := strings.Cut(value, "=")
+	if !found || name == "" {
+		return fmt.Errorf("expected ABBR=offset, e.g. \"IST=+05:30\"")
+	}
+	var t time.Time
+	var err error
+	for _, layout := range []string{"-07:00", "-0700", "-07"} {
+		if t, err = time.Parse(layout, offset); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid offset %q, expected e.g. +05:30 or -0700", offset)
+	}
+	if *z == nil {
+		*z = zoneAbbreviations{}
+	}
+	_, seconds := t.Zone()
+	(*z)[name] = time.FixedZone(name, seconds)
+	return nil
+}
+
+// locations returns the timezones of files for logmerge.Options.Locations,
+// nil without rules.
+func (f fileTimezones) locations(files []string) []*time.Location {
+	if len(f) == 0 {
+		return nil
+	}
+	locations := make([]*time.Location, len(files))
+	for i, file := range files {
+		locations[i] = f.location(file)
+	}
+	return locations
+}
+
+// isDuplicate reports whether line has the timestamp and text of previous,
+// for -dedup. With perFile, for -dedup-scope=file, it must also be from the
+// same file.
+func isDuplicate(line, previous logmerge.Line, perFile bool) bool {
+	return line.Timestamp.Equal(previous.Timestamp) && line.RestOfLine == previous.RestOfLine &&
+		(!perFile || line.Filename == previous.Filename)
+}
+
+// sampler keeps every nth line for -sample, counting all lines or, with
+// perFile, the lines of each file.
+type sampler struct {
+	n       int
+	perFile bool
+	seen    int            // lines offered
+	kept    int            // lines kept
+	counts  map[string]int // with perFile, lines offered per file
+}
+
+// parseSample parses a -sample value, 1/N or N.
+func parseSample(value string) (int, error) {
+	value = strings.TrimPrefix(value, "1/")
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("expected 1/N or N with N >= 1, e.g. 1/100")
+	}
+	return n, nil
+}
+
+// keep reports whether the next line of filename is kept. The first line is.
+func (s *sampler) keep(filename string) bool {
+	count := s.seen
+	if s.perFile {
+		if s.counts == nil {
+			s.counts = map[string]int{}
+		}
+		count = s.counts[filename]
+		s.counts[filename]++
+	}
+	s.seen++
+	if count%s.n != 0 {
+		return false
+	}
+	s.kept++
+	return true
+}
+
+// coalescer folds runs of consecutive lines of the same file with the same
+// message, or the same first prefix bytes of it, into their first line for
+// -coalesce, as long as they are within window of it.
+type coalescer struct {
+	window    time.Duration
+	prefix    int           // compare only the first prefix bytes of the messages, unless 0
+	run       logmerge.Line // first line of the current run
+	count     int           // lines in the run, 0 before the first line
+	coalesced int           // lines folded into a previous one
+}
+
+// add adds line. If it starts a new run, the previous run is returned with
+// ok, as its first line with " (xN)" appended for N > 1 lines.
+func (c *coalescer) add(line logmerge.Line) (logmerge.Line, bool) {
+	if c.count > 0 && line.Filename == c.run.Filename && c.sameMessage(line.RestOfLine, c.run.RestOfLine) &&
+		line.Timestamp.Sub(c.run.Timestamp) <= c.window {
+		c.count++
+		c.coalesced++
+		return logmerge.Line{}, false
+	}
+	previous, ok := c.flush()
+	c.run, c.count = line, 1
+	return previous, ok
+}
+
+// flush ends the current run and returns it like add, if there is one.
+func (c *coalescer) flush() (logmerge.Line, bool) {
+	if c.count == 0 {
+		return logmerge.Line{}, false
+	}
+	line := c.run
+	if c.count > 1 {
+		line.RestOfLine += fmt.Sprintf(" (x%d)", c.count)
+	}
+	c.count = 0
+	return line, true
+}
+
+func (c *coalescer) sameMessage(a, b string) bool {
+	if c.prefix > 0 {
+		a, b = a[:min(len(a), c.prefix)], b[:min(len(b), c.prefix)]
+	}
+	return a == b
+}
+
+// recentLines remembers the hashes of the lines output within window of the
+// latest one, for -merge-equal-files.
+type recentLines struct {
+	window     time.Duration
+	seed       maphash.Seed
+	queue      []recentLine         // in output order, the oldest first
+	latest     map[uint64]time.Time // per hash, the timestamp of its latest line
+	suppressed int                  // lines dropped as seen recently
+}
+
+type recentLine struct {
+	hash      uint64
+	timestamp time.Time
+}
+
+func newRecentLines(window time.Duration) *recentLines {
+	return &recentLines{window: window, seed: maphash.MakeSeed(), latest: map[uint64]time.Time{}}
+}
+
+// seen reports whether a line with the text of line was output within window
+// before it. If not, line is remembered as output.
+func (r *recentLines) seen(line logmerge.Line) bool {
+	// forget the lines that are out of the window
+	cutoff := line.Timestamp.Add(-r.window)
+	n := 0
+	for n < len(r.queue) && r.queue[n].timestamp.Before(cutoff) {
+		if old := r.queue[n]; r.latest[old.hash].Equal(old.timestamp) {
+			delete(r.latest, old.hash)
+		}
+		n++
+	}
+	r.queue = r.queue[n:]
+
+	hash := maphash.String(r.seed, line.RestOfLine)
+	if _, found := r.latest[hash]; found {
+		r.suppressed++
+		return true
+	}
+	r.queue = append(r.queue, recentLine{hash: hash, timestamp: line.Timestamp})
+	r.latest[hash] = line.Timestamp
+	return false
+}
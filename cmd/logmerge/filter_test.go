@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/100days/logmerge"
+)
+
+func TestIsDuplicate(t *testing.T) {
+	t0 := time.Date(2025, time.June, 10, 14, 30, 0, 0, time.UTC)
+	previous := logmerge.Line{Timestamp: t0, Filename: "a.log", RestOfLine: " started"}
+	tests := []struct {
+		name            string
+		line            logmerge.Line
+		anyFile, inFile bool // duplicate with -dedup-scope line and file
+	}{
+		{"same file", logmerge.Line{Timestamp: t0, Filename: "a.log", RestOfLine: " started"}, true, true},
+		{"other file", logmerge.Line{Timestamp: t0, Filename: "b.log", RestOfLine: " started"}, true, false},
+		{"other text", logmerge.Line{Timestamp: t0, Filename: "a.log", RestOfLine: " stopped"}, false, false},
+		{"other time", logmerge.Line{Timestamp: t0.Add(time.Millisecond), Filename: "a.log", RestOfLine: " started"}, false, false},
+		{"same instant", logmerge.Line{Timestamp: t0.In(time.FixedZone("", 3600)), Filename: "a.log", RestOfLine: " started"}, true, true},
+	}
+	for _, tt := range tests {
+		if got := isDuplicate(tt.line, previous, false); got != tt.anyFile {
+			t.Errorf("%s: scope line: got %v, want %v", tt.name, got, tt.anyFile)
+		}
+		if got := isDuplicate(tt.line, previous, true); got != tt.inFile {
+			t.Errorf("%s: scope file: got %v, want %v", tt.name, got, tt.inFile)
+		}
+	}
+}
+
+func TestZoneAbbreviationsSet(t *testing.T) {
+	tests := []struct {
+		value   string
+		name    string
+		seconds int
+		ok      bool
+	}{
+		{"IST=+05:30", "IST", 5*3600 + 1800, true},
+		{"MSK=+0300", "MSK", 3 * 3600, true},
+		{"NST=-03:30", "NST", -(3*3600 + 1800), true},
+		{"XT=-07", "XT", -7 * 3600, true},
+		{"IST", "", 0, false},
+		{"=+05:30", "", 0, false},
+		{"IST=India", "", 0, false},
+	}
+	for _, tt := range tests {
+		var z zoneAbbreviations
+		err := z.Set(tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: error %v, want ok %v", tt.value, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		zone := z[tt.name]
+		if len(z) != 1 || zone == nil {
+			t.Errorf("%q: got %v, want only %s", tt.value, z.String(), tt.name)
+			continue
+		}
+		name, seconds := time.Time{}.In(zone).Zone()
+		if name != tt.name || seconds != tt.seconds {
+			t.Errorf("%q: got %v, want %s at %d seconds", tt.value, z.String(), tt.name, tt.seconds)
+		}
+	}
+	// later rules override earlier ones
+	var z zoneAbbreviations
+	for _, value := range []string{"IST=+05:30", "CST=+08:00", "IST=+01:00"} {
+		if err := z.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := z.String(), "CST=+08:00, IST=+01:00"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
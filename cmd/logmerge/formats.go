@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/100days/logmerge"
+)
+
+// formatSample is the time of the examples of -list-formats, in a zone with
+// an abbreviation and an offset, so that layouts show both.
+var formatSample = time.Date(2025, time.June, 10, 14, 30, 0, 123456789, time.FixedZone("MST", -7*3600))
+
+// listFormats prints a table of patterns for -list-formats to w: their name,
+// layout and an example, with verbose also the regular expression.
+func listFormats(w io.Writer, patterns []logmerge.Pattern, verbose bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := "Name\tLayout\tExample"
+	if verbose {
+		header += "\tPattern"
+	}
+	_, _ = fmt.Fprintln(tw, header)
+	for _, pattern := range patterns {
+		name := pattern.Name
+		if name == "" {
+			name = "-"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s", name, pattern.Layout, formatExample(pattern.Layout, formatSample))
+		if verbose {
+			_, _ = fmt.Fprintf(tw, "\t%s", pattern.Regex)
+		}
+		_, _ = fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+// formatExample formats t with layout, a Go time layout or one of the special
+// layouts of logmerge.
+func formatExample(layout string, t time.Time) string {
+	switch layout {
+	case logmerge.EpochSecondsLayout:
+		return fmt.Sprintf("%d.%03d", t.Unix(), t.Nanosecond()/int(time.Millisecond))
+	case logmerge.EpochMillisLayout:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	case logmerge.ISOWeekLayout:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d-%d%s", year, week, (int(t.Weekday())+6)%7+1, t.Format("T15:04:05"))
+	}
+	return t.Format(layout)
+}
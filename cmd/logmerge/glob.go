@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expandGlob expands pattern like filepath.Glob, additionally supporting "**"
+// as a path element matching any number of directories, e.g. logs/**/*.log.
+// Symlinked directories are followed once; with skipHidden, directories whose
+// name starts with a dot are not descended into.
+func expandGlob(pattern string, skipHidden bool) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	for _, segment := range segments {
+		if _, err := filepath.Match(segment, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	// walk from the longest prefix without wildcards
+	static := 0
+	for static < len(segments) && !strings.ContainsAny(segments[static], `*?[\`) {
+		static++
+	}
+	root := filepath.FromSlash(strings.Join(segments[:static], "/"))
+	if root == "" {
+		if static > 0 {
+			root = string(filepath.Separator)
+		} else {
+			root = "."
+		}
+	}
+
+	var matches []string
+	visited := map[string]bool{}
+	err := walkFiles(root, nil, skipHidden, visited, func(path string, rel []string) {
+		if matchSegments(segments[static:], rel) {
+			matches = append(matches, path)
+		}
+	})
+	return matches, err
+}
+
+// walkFiles calls fn for every regular file below dir, with rel being its
+// path elements relative to the walk root. visited holds the resolved
+// directories already walked, which guards against symlink loops.
+func walkFiles(dir string, rel []string, skipHidden bool, visited map[string]bool, fn func(path string, rel []string)) error {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if visited[resolved] {
+		return nil
+	}
+	visited[resolved] = true
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		entryRel := append(rel[:len(rel):len(rel)], entry.Name())
+		info, err := os.Stat(path) // follows symlinks
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			if skipHidden && strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			if err := walkFiles(path, entryRel, skipHidden, visited, fn); err != nil {
+				logWarnf("Skipping directory %s: %s\n", path, err)
+			}
+		} else if info.Mode().IsRegular() {
+			fn(path, entryRel)
+		}
+	}
+	return nil
+}
+
+// matchSegments matches path elements against pattern elements, where "**"
+// matches zero or more path elements.
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := filepath.Match(pattern[0], name[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], name[1:])
+}
+
+// expandDirectories replaces the directories among matches by the files below
+// them if recursive, like dir/**/*, or else drops them and returns them as
+// skipped.
+func expandDirectories(matches []string, recursive, skipHidden bool) (files, skipped []string, err error) {
+	for _, match := range matches {
+		fi, statErr := os.Stat(match)
+		if statErr != nil || !fi.IsDir() {
+			// a file, or an error that opening it reports
+			files = append(files, match)
+			continue
+		}
+		if !recursive {
+			skipped = append(skipped, match)
+			continue
+		}
+		below, err := expandGlob(filepath.Join(match, "**", "*"), skipHidden)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, below...)
+	}
+	return files, skipped, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// makeTree creates the files, with their parent directories, below dir.
+func makeTree(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExpandGlobDirectories(t *testing.T) {
+	dir := t.TempDir()
+	makeTree(t, dir, "a.log", "app.log/current", "app.log/.old/x.log", "b.log", "sub/c.log", "sub/deep/d.log")
+	rel := func(files []string) []string {
+		for i, file := range files {
+			files[i], _ = filepath.Rel(dir, file)
+			files[i] = filepath.ToSlash(files[i])
+		}
+		return files
+	}
+
+	tests := []struct {
+		pattern               string
+		recursive, skipHidden bool
+		files, skipped        []string
+	}{
+		{"*.log", false, false, []string{"a.log", "b.log"}, []string{"app.log"}},
+		{"*.log", true, false, []string{"a.log", "app.log/.old/x.log", "app.log/current", "b.log"}, nil},
+		{"*.log", true, true, []string{"a.log", "app.log/current", "b.log"}, nil},
+		{"sub", false, false, nil, []string{"sub"}},
+		{"sub", true, false, []string{"sub/c.log", "sub/deep/d.log"}, nil},
+		{"**/*.log", false, false, []string{"a.log", "app.log/.old/x.log", "b.log", "sub/c.log", "sub/deep/d.log"}, nil},
+		{"**/*.log", false, true, []string{"a.log", "b.log", "sub/c.log", "sub/deep/d.log"}, nil},
+		{"missing.log", false, false, nil, nil},
+	}
+	for _, tt := range tests {
+		matches, err := expandGlob(filepath.Join(dir, tt.pattern), tt.skipHidden)
+		if err != nil {
+			t.Errorf("%s: %v", tt.pattern, err)
+			continue
+		}
+		files, skipped, err := expandDirectories(matches, tt.recursive, tt.skipHidden)
+		if err != nil {
+			t.Errorf("%s: %v", tt.pattern, err)
+			continue
+		}
+		if files, skipped := rel(files), rel(skipped); !slices.Equal(files, tt.files) || !slices.Equal(skipped, tt.skipped) {
+			t.Errorf("%s, recursive %v, skip hidden %v: got %q, skipped %q, want %q, skipped %q",
+				tt.pattern, tt.recursive, tt.skipHidden, files, skipped, tt.files, tt.skipped)
+		}
+	}
+}
+
+func TestExpandGlobSymlinkLoop(t *testing.T) {
+	dir := t.TempDir()
+	makeTree(t, dir, "a.log", "sub/b.log")
+	// dir/link -> dir, and dir/sub/up -> dir through the parent
+	if err := os.Symlink(dir, filepath.Join(dir, "link")); err != nil {
+		t.Skip(err)
+	}
+	if err := os.Symlink("..", filepath.Join(dir, "sub", "up")); err != nil {
+		t.Skip(err)
+	}
+
+	tests := []struct {
+		pattern   string
+		recursive bool
+	}{
+		{"**/*.log", false},
+		{".", true},
+		{"link", true},
+	}
+	for _, tt := range tests {
+		type result struct {
+			files []string
+			err   error
+		}
+		done := make(chan result, 1)
+		go func() {
+			matches, err := expandGlob(filepath.Join(dir, tt.pattern), false)
+			if err != nil {
+				done <- result{nil, err}
+				return
+			}
+			files, _, err := expandDirectories(matches, tt.recursive, false)
+			done <- result{files, err}
+		}()
+		select {
+		case r := <-done:
+			if r.err != nil {
+				t.Errorf("%s: %v", tt.pattern, r.err)
+				continue
+			}
+			var names []string
+			for _, file := range r.files {
+				names = append(names, filepath.Base(file))
+			}
+			if want := []string{"a.log", "b.log"}; !slices.Equal(names, want) {
+				t.Errorf("%s: got %q, want each of %q once", tt.pattern, r.files, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s: expanding does not end", tt.pattern)
+		}
+	}
+}
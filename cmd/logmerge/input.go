@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/100days/logmerge"
+	"github.com/klauspost/compress/zstd"
+)
+
+// stdinArg is the file argument that makes logmerge read from standard input.
+const stdinArg = "-"
+const stdinName = "<stdin>"
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	// "BZh", the block size 1-9 and the magic of the first block, or of the
+	// end of an empty stream, so that text starting with BZh is not mistaken
+	bzip2Magic      = []byte("BZh")
+	bzip2BlockMagic = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	bzip2EndMagic   = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+)
+
+// isBzip2 reports whether magic, the first 10 bytes of a file, start a bzip2
+// stream.
+func isBzip2(magic []byte) bool {
+	if len(magic) < 10 || !bytes.HasPrefix(magic, bzip2Magic) || magic[3] < '1' || magic[3] > '9' {
+		return false
+	}
+	return bytes.Equal(magic[4:], bzip2BlockMagic) || bytes.Equal(magic[4:], bzip2EndMagic)
+}
+
+// decompressReader sniffs the first bytes of r and transparently wraps it in a
+// decompressing reader if it holds compressed data. Plain text is returned as
+// is. Closing the result releases the decompressor, but does not close r.
+// compression is gzip, zstd, bzip2 or "" for plain text.
+func decompressReader(r io.Reader) (rc io.ReadCloser, compression string, err error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(10)
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		rc, err = gzip.NewReader(br)
+		return rc, "gzip", err
+	case bytes.HasPrefix(magic, zstdMagic):
+		// decode synchronously, without goroutines per file
+		dec, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, "zstd", err
+		}
+		return dec.IOReadCloser(), "zstd", nil
+	case isBzip2(magic):
+		// bzip2 has nothing to release
+		return io.NopCloser(bzip2.NewReader(br)), "bzip2", nil
+	}
+	return io.NopCloser(br), "", nil
+}
+
+// followInterval is how often a followed file is polled for new data.
+const followInterval = 250 * time.Millisecond
+
+// followReader reads from r like tail -f: at the end of the input it waits for
+// more data to be appended instead of returning io.EOF, until ctx is done.
+type followReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (f followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := f.r.Read(p)
+		if err == io.EOF {
+			if n > 0 {
+				return n, nil
+			}
+			select {
+			case <-time.After(followInterval):
+			case <-f.ctx.Done():
+				return 0, f.ctx.Err()
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// guardedReader serializes the reads of a decompressor with its Close. The
+// merge may still be reading an input when it ended early, e.g. with -head.
+type guardedReader struct {
+	mu     sync.Mutex
+	rc     io.ReadCloser
+	closed bool
+	// reads of standard input are not ended by closing it
+	stdin bool
+}
+
+func (g *guardedReader) Read(p []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return 0, os.ErrClosed
+	}
+	return g.rc.Read(p)
+}
+
+// Close closes the decompressor once a read in progress returned, which
+// inputs.Close ends by closing the file under it first. A read of standard
+// input may wait for more input indefinitely, so its decompressor is closed
+// when that read returns, without waiting for it.
+func (g *guardedReader) Close() error {
+	if g.stdin && !g.mu.TryLock() {
+		go func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			_ = g.closeLocked()
+		}()
+		return nil
+	}
+	if !g.stdin {
+		g.mu.Lock()
+	}
+	defer g.mu.Unlock()
+	return g.closeLocked()
+}
+
+// closeLocked closes the decompressor with g.mu held.
+func (g *guardedReader) closeLocked() error {
+	if g.closed {
+		return nil
+	}
+	g.closed = true
+	return g.rc.Close()
+}
+
+// inputs are the opened files handed to logmerge.Merge.
+type inputs struct {
+	readers  []io.Reader
+	names    []string
+	modTimes []time.Time
+	// per input, the compression found by decompressReader
+	compressions []string
+	closers      []io.Closer // files and decompressors
+	failed       int         // files that could not be opened
+}
+
+// openInputs opens all files, stdinArg being standard input and http(s) URLs
+// being fetched, and the entries of archives from their copies. Files that
+// cannot be opened are reported and skipped. With follow, regular files are
+// read like tail -f until ctx is done.
+func openInputs(ctx context.Context, allFiles []string, archives *archiveEntries, follow bool) *inputs {
+	in := &inputs{}
+	for _, file := range allFiles {
+		var r io.Reader = os.Stdin
+		name := stdinName
+		var modTime time.Time
+		var fromArchive bool
+		if isURL(file) {
+			body, lastModified, err := openURL(ctx, file)
+			if err != nil {
+				logFileErrorf("Error opening %s: %s\n", file, err)
+				in.failed++
+				continue
+			}
+			in.closers = append(in.closers, body)
+			r, name, modTime = body, file, lastModified
+		} else if file != stdinArg {
+			path := file
+			var entry tarEntry
+			if entry, fromArchive = archives.take(file); fromArchive {
+				path = entry.path
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				logFileErrorf("Error opening file %s: %s\n", file, err)
+				in.failed++
+				continue
+			}
+			in.closers = append(in.closers, f)
+			if fromArchive {
+				// after the file, which is closed first
+				in.closers = append(in.closers, removeFile(path))
+				modTime = entry.modTime
+			} else if fi, err := f.Stat(); err == nil {
+				modTime = fi.ModTime()
+			}
+			r = readProgress.count(f)
+			if follow {
+				r = followReader{ctx: ctx, r: r}
+			}
+			name = file
+		}
+		dr, compression, err := decompressReader(r)
+		if err != nil {
+			logFileErrorf("Error reading file %s: %s\n", name, err)
+			in.failed++
+			continue
+		}
+		// sniffing would wait for more input from a pipe or a followed file;
+		// archives in archives are not extracted
+		if file != stdinArg && !follow && !fromArchive {
+			var isTar bool
+			if dr, isTar = sniffTar(dr); isTar {
+				in.addTar(name, dr)
+				continue
+			}
+		}
+		in.add(dr, name, modTime, compression, file == stdinArg)
+	}
+	return in
+}
+
+// add adds the opened input dr, stdin if it is standard input.
+func (in *inputs) add(dr io.ReadCloser, name string, modTime time.Time, compression string, stdin bool) {
+	g := &guardedReader{rc: dr, stdin: stdin}
+	in.closers = append(in.closers, g)
+	in.readers = append(in.readers, g)
+	in.names = append(in.names, name)
+	in.modTimes = append(in.modTimes, modTime)
+	in.compressions = append(in.compressions, compression)
+}
+
+// addTar adds the regular files in the tar archive r, named like
+// archive.tar/app/app.log, each of them possibly compressed on its own.
+func (in *inputs) addTar(archive string, r io.ReadCloser) {
+	entries, err := extractTar(r)
+	_ = r.Close()
+	if err != nil {
+		logFileErrorf("Error reading archive %s: %s\n", archive, err)
+		in.failed++
+		return
+	}
+	for _, e := range entries {
+		name := archive + archiveSeparator + e.name
+		f, err := os.Open(e.path)
+		if err == nil {
+			in.closers = append(in.closers, f)
+		}
+		// after the file, which is closed first
+		in.closers = append(in.closers, removeFile(e.path))
+		var dr io.ReadCloser
+		var compression string
+		if err == nil {
+			dr, compression, err = decompressReader(f)
+		}
+		if err != nil {
+			logFileErrorf("Error reading file %s: %s\n", name, err)
+			in.failed++
+			continue
+		}
+		in.add(dr, name, e.modTime, compression, false)
+	}
+}
+
+// sources returns the opened inputs with their names for logmerge.MergeSources.
+func (in *inputs) sources() []logmerge.Source {
+	sources := make([]logmerge.Source, len(in.readers))
+	for i, r := range in.readers {
+		sources[i] = logmerge.Source{Name: in.names[i], R: r}
+	}
+	return sources
+}
+
+// Close releases all decompressors and closes all opened files. Calling it
+// again, or on a nil inputs, does nothing.
+func (in *inputs) Close() {
+	if in == nil {
+		return
+	}
+	for _, c := range in.closers {
+		_ = c.Close()
+	}
+	in.closers = nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+// blockingReader blocks reads until release is closed, like a file that
+// inputs.Close closes under a read, or standard input waiting for more.
+type blockingReader struct {
+	reading chan struct{}
+	release chan struct{}
+	closed  chan struct{}
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	close(r.reading)
+	<-r.release
+	return 0, io.EOF
+}
+
+func (r *blockingReader) Close() error {
+	close(r.closed)
+	return nil
+}
+
+func TestGuardedReaderCloseDuringRead(t *testing.T) {
+	tests := []struct {
+		name  string
+		stdin bool
+	}{
+		{"file", false},
+		{"stdin", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &blockingReader{reading: make(chan struct{}), release: make(chan struct{}), closed: make(chan struct{})}
+			g := &guardedReader{rc: r, stdin: tt.stdin}
+			go func() { _, _ = g.Read(make([]byte, 10)) }()
+			<-r.reading
+
+			closeDone := make(chan error)
+			go func() { closeDone <- g.Close() }()
+			if tt.stdin {
+				// returns without waiting for the read
+				if err := <-closeDone; err != nil {
+					t.Fatalf("Close: %v", err)
+				}
+			} else {
+				select {
+				case <-closeDone:
+					t.Fatal("Close returned during the read")
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+			select {
+			case <-r.closed:
+				t.Fatal("decompressor closed during the read")
+			default:
+			}
+
+			close(r.release)
+			select {
+			case <-r.closed:
+			case <-time.After(5 * time.Second):
+				t.Fatal("decompressor not closed after the read")
+			}
+			if !tt.stdin {
+				if err := <-closeDone; err != nil {
+					t.Fatalf("Close: %v", err)
+				}
+			}
+			if _, err := g.Read(make([]byte, 10)); err == nil {
+				t.Error("Read after Close succeeded")
+			}
+		})
+	}
+}
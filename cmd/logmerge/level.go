@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/100days/logmerge"
+)
+
+// level is a log severity, from least to most severe.
+type level int
+
+const (
+	levelUnknown level = iota
+	levelDebug
+	levelInfo
+	levelWarn
+	levelError
+	levelFatal
+)
+
+func (l level) String() string {
+	return [...]string{"UNKNOWN", "DEBUG", "INFO", "WARN", "ERROR", "FATAL"}[l]
+}
+
+// levelNames are the recognized level tokens and abbreviations, upper case.
+var levelNames = map[string]level{
+	"TRACE": levelDebug, "TRC": levelDebug, "DEBUG": levelDebug, "DBG": levelDebug,
+	"INFO": levelInfo, "INF": levelInfo, "NOTICE": levelInfo,
+	"WARN": levelWarn, "WARNING": levelWarn, "WRN": levelWarn,
+	"ERROR": levelError, "ERR": levelError,
+	"FATAL": levelFatal, "FTL": levelFatal, "CRIT": levelFatal, "CRITICAL": levelFatal,
+	"PANIC": levelFatal, "ALERT": levelFatal, "EMERG": levelFatal,
+}
+
+// maxLevelName is the length of the longest key of levelNames.
+const maxLevelName = 8
+
+// parseLevel parses a -level value, any of levelNames in any case.
+func parseLevel(value string) (level, error) {
+	if l, ok := levelNames[strings.ToUpper(value)]; ok {
+		return l, nil
+	}
+	return levelUnknown, fmt.Errorf("unknown level %q, expected DEBUG, INFO, WARN, ERROR or FATAL", value)
+}
+
+// klogLevels are the severity letters of klog, which directly precede the
+// timestamp, like I0610 14:30:00.123456.
+var klogLevels = map[byte]level{'I': levelInfo, 'W': levelWarn, 'E': levelError, 'F': levelFatal}
+
+// logcatLevels are the priority letters of Android logcat, which follow the
+// pid and tid in its threadtime format, 06-10 14:30:00.123  1234  5678 I Tag:,
+// and precede the tag in its time format, 06-10 14:30:00.123 I/Tag( 1234):.
+var logcatLevels = map[byte]level{
+	'V': levelDebug, 'D': levelDebug, 'I': levelInfo, 'W': levelWarn, 'E': levelError, 'F': levelFatal, 'A': levelFatal,
+}
+
+var logcatLevel = regexp.MustCompile(`^ +(?:\d+ +\d+ )?([VDIWEFA])[ /]`)
+
+// lineLevel returns the level of line: that of a klog or logcat severity
+// letter, or else that detectLevel finds in its message.
+func lineLevel(line logmerge.Line) level {
+	if line.RawOffset == 1 && line.RestOfLine != "" {
+		if l, found := klogLevels[line.RestOfLine[0]]; found {
+			return l
+		}
+	}
+	if line.RawOffset == 0 && isLogcatTimestamp(line.RawTimestamp) {
+		if m := logcatLevel.FindStringSubmatch(line.RestOfLine); m != nil {
+			return logcatLevels[m[1][0]]
+		}
+	}
+	return detectLevel(line.RestOfLine)
+}
+
+// isLogcatTimestamp reports whether timestamp looks like 06-10 14:30:00.123.
+func isLogcatTimestamp(timestamp string) bool {
+	return len(timestamp) == 18 && timestamp[2] == '-' && timestamp[5] == ' ' && timestamp[14] == '.'
+}
+
+// detectLevel returns the level of the first word of text that is one of
+// levelNames, in any case, e.g. "INFO", "[warn]" or "level=error". Words are
+// runs of ASCII letters.
+func detectLevel(text string) level {
+	var word [maxLevelName]byte
+	for i := 0; i < len(text); {
+		if !isLetter(text[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(text) && isLetter(text[i]) {
+			i++
+		}
+		if i-start > maxLevelName {
+			continue
+		}
+		for j := start; j < i; j++ {
+			word[j-start] = text[j] &^ 0x20 // upper case
+		}
+		if l, ok := levelNames[string(word[:i-start])]; ok {
+			return l
+		}
+	}
+	return levelUnknown
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
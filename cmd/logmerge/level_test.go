@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/100days/logmerge"
+)
+
+func TestLineLevel(t *testing.T) {
+	tests := []struct {
+		line string
+		want level
+	}{
+		{"2025-06-10 14:30:00 INFO started", levelInfo},
+		{"2025-06-10 14:30:00 [warn] slow", levelWarn},
+		{"2025-06-10 14:30:00 level=error msg=failed", levelError},
+		{"2025-06-10 14:30:00 nothing to see", levelUnknown},
+		// klog
+		{"I0610 14:30:00.123456   123 main.go:42] error in the message", levelInfo},
+		{"E0610 14:30:00.123456   123 main.go:42] msg", levelError},
+		// logcat threadtime and time
+		{"06-10 14:30:00.123  1234  5678 W Tag: msg", levelWarn},
+		{"06-10 14:30:00.123  1234  5678 V Tag: error in the message", levelDebug},
+		{"06-10 14:30:00.123  1234  5678 F Tag: msg", levelFatal},
+		{"06-10 14:30:00.123 E/Tag( 1234): msg", levelError},
+		{"06-10 14:30:00.123 D/Tag( 1234): msg", levelDebug},
+	}
+	for _, tt := range tests {
+		line, _, err := logmerge.Detect(strings.NewReader(tt.line), logmerge.Options{})
+		if err != nil {
+			t.Errorf("%q: %v", tt.line, err)
+			continue
+		}
+		if got := lineLevel(line); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.line, got, tt.want)
+		}
+	}
+}
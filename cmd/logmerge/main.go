@@ -0,0 +1,1017 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/100days/logmerge"
+)
+
+// logLevel is the least level logger reports, raised by -quiet.
+var logLevel = new(slog.LevelVar)
+
+// logger reports warnings and the errors with single files, which do not
+// stop logmerge; errorLogger reports the errors that do, whatever -quiet.
+var (
+	logger      = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+	errorLogger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+)
+
+// quietMode is the value of the -quiet flag: warnings, given as just -quiet,
+// drops the warnings, errors also the errors with single files.
+type quietMode string
+
+const (
+	quietOff      quietMode = ""
+	quietWarnings quietMode = "warnings"
+	quietErrors   quietMode = "errors"
+)
+
+func (q *quietMode) String() string { return string(*q) }
+
+func (q *quietMode) Set(value string) error {
+	switch value {
+	case "false":
+		*q = quietOff
+	case "true", string(quietWarnings):
+		*q = quietWarnings
+	case string(quietErrors):
+		*q = quietErrors
+	default:
+		return fmt.Errorf("must be warnings or errors")
+	}
+	return nil
+}
+
+// IsBoolFlag allows -quiet without value.
+func (q *quietMode) IsBoolFlag() bool { return true }
+
+// countMode is the value of the -count flag: total, given as just -count, or
+// by-file.
+type countMode string
+
+const (
+	countOff    countMode = ""
+	countTotal  countMode = "total"
+	countByFile countMode = "by-file"
+)
+
+func (c *countMode) String() string { return string(*c) }
+
+func (c *countMode) Set(value string) error {
+	switch value {
+	case "false":
+		*c = countOff
+	case "true", string(countTotal):
+		*c = countTotal
+	case string(countByFile):
+		*c = countByFile
+	default:
+		return fmt.Errorf("must be total or by-file")
+	}
+	return nil
+}
+
+// IsBoolFlag allows -count without value.
+func (c *countMode) IsBoolFlag() bool { return true }
+
+// level returns the least level logger reports with q.
+func (q quietMode) level() slog.Level {
+	switch q {
+	case quietWarnings:
+		return slog.LevelError
+	case quietErrors:
+		return slog.LevelError + 1
+	}
+	return slog.LevelInfo
+}
+
+// Exit codes besides 0, which means at least one line was output.
+const (
+	exitError   = 1 // invalid arguments, or no file could be read
+	exitNoLines = 2 // the files were read but no line was output
+
+	exitInterrupted = 130 // stopped by SIGINT or SIGTERM, after writing the output so far
+)
+
+// cleanups are the functions registered with atExit.
+var cleanups []func()
+
+// atExit registers f to be run by exit, such as removing temporary files.
+func atExit(f func()) {
+	cleanups = append(cleanups, f)
+}
+
+// exit runs the functions registered with atExit, the last one first, and
+// exits with code. main exits only through it, as os.Exit skips deferred
+// calls.
+func exit(code int) {
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+	cleanups = nil
+	os.Exit(code)
+}
+
+func logErrorf(format string, args ...interface{}) {
+	errorLogger.Error(fmt.Sprintf(format, args...))
+}
+
+// logFileErrorf reports an error with a single file, which -quiet=errors drops.
+func logFileErrorf(format string, args ...interface{}) {
+	logger.Error(fmt.Sprintf(format, args...))
+}
+func logWarnf(format string, args ...interface{}) {
+	logger.Warn(fmt.Sprintf(format, args...))
+}
+func PrintfStderr(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(os.Stderr, format, args...)
+}
+
+// defaultBuffer is the default of -buffer.
+const defaultBuffer = 1024
+
+// timeSpecLayout is the layout of absolute -start and -end times.
+const timeSpecLayout = "2006-01-02T15:04:05"
+
+// parseTimeSpec parses a -start or -end value: an absolute time in
+// timeSpecLayout, "now", or a duration relative to now such as -1h30m
+// (negative is in the past). The absolute form takes precedence.
+func parseTimeSpec(value string, now time.Time) (time.Time, error) {
+	t, err := time.Parse(timeSpecLayout, value)
+	if err == nil {
+		return t, nil
+	}
+	if value == "now" {
+		return now, nil
+	}
+	if d, durationErr := time.ParseDuration(value); durationErr == nil {
+		return now.Add(d), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a time like %s, now, nor a duration like -1h", value, timeSpecLayout)
+}
+
+// separatorEscapes are the escape sequences of a -sep value.
+var separatorEscapes = map[byte]string{'t': "\t", 'n': "\n", 'r': "\r", '0': "\x00", '\\': "\\"}
+
+// unescapeSeparator decodes the escape sequences \t, \n, \r, \0 and \\ of
+// a -sep value, as the shell passes them literally.
+func unescapeSeparator(value string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		if i == len(value) {
+			return "", fmt.Errorf("%q ends in a lone backslash, use \\\\ for a backslash", value)
+		}
+		decoded, found := separatorEscapes[value[i]]
+		if !found {
+			return "", fmt.Errorf("unknown escape sequence \\%c in %q, expected \\t, \\n, \\r, \\0 or \\\\", value[i], value)
+		}
+		b.WriteString(decoded)
+	}
+	return b.String(), nil
+}
+
+// parseColumns parses a -ts-cols value, the 1-based inclusive columns
+// start:end, into the byte range [from, to) of a line.
+func parseColumns(value string) (from, to int, err error) {
+	startStr, endStr, found := strings.Cut(value, ":")
+	start, startErr := strconv.Atoi(startStr)
+	end, endErr := strconv.Atoi(endStr)
+	if !found || startErr != nil || endErr != nil || start < 1 || end < start {
+		return 0, 0, fmt.Errorf("expected start:end with 1 <= start <= end, e.g. 1:23")
+	}
+	return start - 1, end, nil
+}
+
+func main() {
+	// Define command-line flags for start and end times
+	startTimeStr := flag.String("start", "", "Start time (format: 2006-01-02T15:04:05, now, or relative to now like -1h)")
+	endTimeStr := flag.String("end", "", "End time (format: 2006-01-02T15:04:05, now, or relative to now like -10m)")
+	fieldSeparator := flag.String("sep", " ", "Field separator, with the escape sequences \\t, \\n, \\r, \\0 and \\\\")
+	fieldSeparator1 := flag.String("sep1", "", "Separator after the timestamp, like -sep (default -sep)")
+	fieldSeparator2 := flag.String("sep2", "", "Separator before the message, after the filename and line number, like -sep (default -sep)")
+	nameLen := flag.Int("namelen", 20, "Length of the filename column: the last N characters of the base name, 0 for the full path, -1 for the whole base name")
+	verbose := flag.Bool("v", false, "Verbose output")
+	outputFormat := flag.String("format", "text", "Output format: text, json, logfmt or csv")
+	tmpl := flag.String("template", "", "Go text/template per output line, with .Timestamp, .File, .Message and .LineNo, e.g. '{{format \"15:04:05\" .Timestamp}} {{.Message}}' (replaces -format)")
+	csvHeader := flag.Bool("csv-header", true, "Start the csv output with a header row")
+	outputLayout := flag.String("outfmt", defaultOutputLayout, "Go time layout of the output timestamps, e.g. \"2006-01-02 15:04:05.000000\"")
+	keepTimestamp := flag.Bool("keep-ts", false, "Print each line verbatim, with its original timestamp, after the filename")
+	delta := flag.Bool("delta", false, "Start each line with the time since the previous output line, e.g. +0.123s (text format only)")
+	lineNo := flag.Bool("lineno", false, "Add the line number in its file after the filename (text, json, logfmt and csv formats)")
+	index := flag.Bool("index", false, "Replace the filename with the position of the file among all files, like [3], and print their legend to stderr")
+	noFilename := flag.Bool("no-filename", false, "Omit the filename column, or the file field of the json, logfmt and csv formats")
+	markers := flag.Bool("markers", false, "Write a marker line between lines of different files (text format only)")
+	markerFormat := flag.String("marker-format", "----- "+markerFile+" -----", "The marker line of -markers, empty for a blank line, "+markerFile+" being replaced with the base name of the file, or its full path with -namelen 0")
+	keepInMessage := flag.Bool("keep-in-message", false, "Keep the original timestamp in the message, besides the timestamp column")
+	timezone := flag.String("tz", "", "IANA timezone of timestamps without offset, e.g. America/New_York (default UTC)")
+	var fileTZ fileTimezones
+	var tzAbbreviations zoneAbbreviations
+	flag.Var(&tzAbbreviations, "tz-abbr", "Offset of a zone abbreviation like MST in timestamps, e.g. \"IST=+05:30\" (repeatable, overrides -tz and the built-in US and European ones)")
+	flag.Var(&fileTZ, "file-tz", "Timezone of the files matching a glob, e.g. \"eu-*.log=Europe/Berlin\" (repeatable, first match wins, overrides -tz)")
+	follow := flag.Bool("f", false, "Follow the files like tail -f and keep merging appended lines")
+	recursive := flag.Bool("recursive", false, "Merge the files below directories given or matched by a glob, instead of skipping them")
+	skipHidden := flag.Bool("skip-hidden", false, "Do not descend into hidden directories when expanding **")
+	color := colorNever
+	flag.Var(&color, "color", "Color the filename column: always, never or auto (only if stdout is a terminal), or level to color lines by their level on a terminal")
+	orphanLines := flag.String("orphan-lines", "attach", "Lines without timestamp: attach (with the timestamp of the previous line of their file), drop, or inline (as they are, text format only)")
+	multiline := flag.Bool("multiline", false, "Keep lines without timestamp (e.g. stack traces) together with the previous line")
+	preamble := flag.Bool("preamble", false, "Keep the lines before the first timestamp of a file (e.g. a banner) together with its first timestamped line")
+	requireTimestamps := flag.Int("require-timestamps", 0, "Report a file as unreadable if its first N lines have no timestamp (0 = never)")
+	skipBinary := flag.Bool("skip-binary", false, "Report a file as unreadable if it has a NUL byte before or in its first line with timestamp")
+	maxLine := flag.Int("maxline", logmerge.DefaultMaxLineLength, "Maximum length of a line in bytes")
+	var include, exclude regexpList
+	flag.Var(&include, "grep", "Only output lines matching this regular expression (repeatable, any may match)")
+	flag.Var(&exclude, "grep-v", "Drop lines matching this regular expression (repeatable, takes precedence over -grep)")
+	var teeLevels teeRules
+	flag.Var(&teeLevels, "tee-level", "Also write the output lines of at least a level to a file, e.g. ERROR=errors.log (repeatable)")
+	outPath := flag.String("out", "", "Write the output to this file instead of stdout, gzip-compressed if it ends in .gz")
+	maxOpen := flag.Int("max-open", 1000, "Maximum number of files open at once, more are merged in batches via temporary files (0 = no limit)")
+	headLines := flag.Int("head", 0, "Only output the first N lines (after -start/-end and the filters)")
+	tailLines := flag.Int("tail", 0, "Only output the last N lines (after -start/-end and the filters)")
+	reverse := flag.Bool("reverse", false, "Output the newest line first, buffering the whole output in memory unless -head or -tail is given")
+	sanitize := flag.Bool("sanitize", false, "Replace invalid UTF-8 in the lines with the replacement character U+FFFD, instead of passing the bytes through")
+	utc := flag.Bool("utc", false, "Convert the output timestamps to UTC, whatever the offset or timezone they were read in")
+	minLevel := flag.String("level", "", "Only output lines of at least this severity: DEBUG, INFO, WARN, ERROR or FATAL")
+	unknownLevels := flag.String("level-unknown", "pass", "With -level, whether lines without a recognized level pass or are dropped: pass|drop")
+	sample := flag.String("sample", "", "Only output every Nth line, given as 1/N or N, after the filters and -dedup")
+	samplePerFile := flag.Bool("sample-per-file", false, "With -sample, output every Nth line of each file instead of the merged stream")
+	dedup := flag.Bool("dedup", false, "Drop a line with the same timestamp and text as the previous output line, whichever file it is from")
+	dedupScope := flag.String("dedup-scope", "line", "With -dedup, whether a duplicate may come from any file (line) or only from the file of the previous line (file)")
+	mergeEqual := flag.Duration("merge-equal-files", 0, "Drop a line whose text was output within this duration before, from whichever file, e.g. for overlapping rotated files (0 = off)")
+	coalesce := flag.Duration("coalesce", 0, "Fold consecutive lines of a file with the same message within this duration of the first one into it, marked like (x12)")
+	coalescePrefix := flag.Int("coalesce-prefix", 0, "With -coalesce, only compare the first N bytes of the messages (0 = all)")
+	strict := flag.Bool("strict", false, "Exit with an error if any file cannot be opened")
+	patternsFile := flag.String("patterns", "", "File with additional timestamp patterns, one \"regex<TAB>layout\" per line")
+	rotation := flag.Bool("rotation", false, "Order rotated files like app.log.2.gz, app.log.1, app.log from oldest to newest, for ties between equal timestamps")
+	nullSeparated := flag.Bool("0", false, "The @file lists are NUL-separated paths, as written by find -print0")
+	var excludeFiles globList
+	flag.Var(&excludeFiles, "exclude", "Skip the files matching this glob, e.g. \"*.debug.log\", by base name or, with a /, by path (repeatable)")
+	fnameDate := flag.String("fname-date", "", "Regular expression of the date in the path of files, e.g. 'app-(\\d{4}-\\d{2}-\\d{2})\\.log', to skip files dated outside -start/-end without opening them")
+	fnameLayout := flag.String("fname-layout", "2006-01-02", "Go time layout of the -fname-date date")
+	allowDupes := flag.Bool("allow-dupes", false, "Merge a file as often as it is given, instead of once")
+	tsCols := flag.String("ts-cols", "", "Only search the timestamp in columns start:end of each line, 1-based and inclusive like cut -c, e.g. 1:23 (shorter lines are searched whole)")
+	dateOrder := flag.String("date-order", "", "Order of numeric dates with slashes: mdy, dmy or ymd; only with it are dates like 06/10/2025 14:30:00 read, to avoid guessing")
+	flag.BoolFunc("day-first", "Deprecated: the same as -date-order=dmy", func(value string) error {
+		dayFirst, err := strconv.ParseBool(value)
+		if dayFirst {
+			*dateOrder = string(logmerge.DayMonthYear)
+		}
+		return err
+	})
+	timeout := flag.Duration("timeout", defaultTimeout, "Maximum time to wait for the response to an http(s) URL argument to start (0 = no limit)")
+	showProgress := flag.Bool("progress", false, "Report the percentage of the file bytes read every second on stderr, if it is a terminal or with -v")
+	buffer := flag.Int("buffer", defaultBuffer, "Number of merged lines that may wait for the output (0 = unbuffered)")
+	dryRunFlag := flag.Bool("dry-run", false, "Only print a table of the files with their size, compression and detected timestamp layout, without merging them")
+	var count countMode
+	flag.Var(&count, "count", "Only print how many lines were output, after -start/-end and the filters, or with -count=by-file also per file")
+	summary := flag.Bool("summary", false, "Only print a table of the lines and the first and last timestamp of each file, without merging them")
+	var quiet quietMode
+	flag.Var(&quiet, "quiet", "Drop the warnings on stderr, or with -quiet=errors also the errors with single files; errors that stop logmerge are still reported")
+	listFormatsFlag := flag.Bool("list-formats", false, "Print a table of the recognized timestamp formats with an example, including those of -patterns, and exit")
+	showVersion := flag.Bool("version", false, "Print the version and exit")
+	flag.Parse()
+	logLevel.Set(quiet.level())
+
+	if *showVersion {
+		fmt.Println(versionString())
+		exit(0)
+	}
+
+	if *nameLen < -1 {
+		logErrorf("Error: -namelen must be -1 or larger\n")
+		exit(exitError)
+	}
+	if *requireTimestamps < 0 {
+		logErrorf("Error: -require-timestamps must not be negative\n")
+		exit(exitError)
+	}
+	if *headLines < 0 || *tailLines < 0 {
+		logErrorf("Error: -head and -tail must not be negative\n")
+		exit(exitError)
+	}
+	if *headLines > 0 && *tailLines > 0 {
+		logErrorf("Error: -head and -tail cannot be combined\n")
+		exit(exitError)
+	}
+	if *maxOpen < 0 || *maxOpen == 1 {
+		logErrorf("Error: -max-open must be 0 or at least 2\n")
+		exit(exitError)
+	}
+	separator, err := unescapeSeparator(*fieldSeparator)
+	if err != nil {
+		logErrorf("Error: -sep: %v\n", err)
+		exit(exitError)
+	}
+	separator1, separator2 := separator, separator
+	if *fieldSeparator1 != "" {
+		if separator1, err = unescapeSeparator(*fieldSeparator1); err != nil {
+			logErrorf("Error: -sep1: %v\n", err)
+			exit(exitError)
+		}
+	}
+	if *fieldSeparator2 != "" {
+		if separator2, err = unescapeSeparator(*fieldSeparator2); err != nil {
+			logErrorf("Error: -sep2: %v\n", err)
+			exit(exitError)
+		}
+	}
+	var tsFrom, tsTo int
+	if *tsCols != "" {
+		tsFrom, tsTo, err = parseColumns(*tsCols)
+		if err != nil {
+			logErrorf("Error: -ts-cols: %v\n", err)
+			exit(exitError)
+		}
+	}
+	if *timeout < 0 {
+		logErrorf("Error: -timeout must not be negative\n")
+		exit(exitError)
+	}
+	httpClient = newHTTPClient(*timeout)
+	var threshold level
+	if *minLevel != "" {
+		var err error
+		threshold, err = parseLevel(*minLevel)
+		if err != nil {
+			logErrorf("Error: -level: %v\n", err)
+			exit(exitError)
+		}
+	}
+	if *orphanLines != "attach" && *orphanLines != "drop" && *orphanLines != "inline" {
+		logErrorf("Error: -orphan-lines must be attach, drop or inline\n")
+		exit(exitError)
+	}
+	switch logmerge.DateOrder(*dateOrder) {
+	case "", logmerge.MonthDayYear, logmerge.DayMonthYear, logmerge.YearMonthDay:
+	default:
+		logErrorf("Error: -date-order must be mdy, dmy or ymd\n")
+		exit(exitError)
+	}
+	if *unknownLevels != "pass" && *unknownLevels != "drop" {
+		logErrorf("Error: -level-unknown must be pass or drop\n")
+		exit(exitError)
+	}
+	if *dedupScope != "line" && *dedupScope != "file" {
+		logErrorf("Error: -dedup-scope must be line or file\n")
+		exit(exitError)
+	}
+	var sampling *sampler
+	if *sample != "" {
+		n, err := parseSample(*sample)
+		if err != nil {
+			logErrorf("Error: -sample: %v\n", err)
+			exit(exitError)
+		}
+		sampling = &sampler{n: n, perFile: *samplePerFile}
+	}
+	if *coalesce < 0 || *coalescePrefix < 0 {
+		logErrorf("Error: -coalesce and -coalesce-prefix must not be negative\n")
+		exit(exitError)
+	}
+	if *mergeEqual < 0 {
+		logErrorf("Error: -merge-equal-files must not be negative\n")
+		exit(exitError)
+	}
+	var recent *recentLines
+	if *mergeEqual > 0 {
+		recent = newRecentLines(*mergeEqual)
+	}
+	var coalescing *coalescer
+	if *coalesce > 0 {
+		coalescing = &coalescer{window: *coalesce, prefix: *coalescePrefix}
+	}
+	if *buffer < 0 {
+		logErrorf("Error: -buffer must not be negative\n")
+		exit(exitError)
+	}
+	if *maxLine <= 0 {
+		logErrorf("Error: -maxline must be positive\n")
+		exit(exitError)
+	}
+	location := time.UTC
+	if *timezone != "" {
+		var err error
+		location, err = time.LoadLocation(*timezone)
+		if err != nil {
+			logErrorf("Error loading timezone: %v\n", err)
+			exit(exitError)
+		}
+	}
+	var patterns []logmerge.Pattern
+	if *patternsFile != "" {
+		var err error
+		patterns, err = logmerge.LoadPatterns(*patternsFile)
+		if err != nil {
+			logErrorf("Error loading timestamp patterns: %v\n", err)
+			exit(exitError)
+		}
+	}
+	if *listFormatsFlag {
+		active, err := logmerge.ActivePatterns(logmerge.Options{Patterns: patterns, DateOrder: logmerge.DateOrder(*dateOrder)})
+		if err == nil {
+			err = listFormats(os.Stdout, active, *verbose)
+		}
+		if err != nil {
+			logErrorf("Error: %v\n", err)
+			exit(exitError)
+		}
+		exit(0)
+	}
+
+	if err := logmerge.ValidateLayout(*outputLayout); err != nil {
+		logErrorf("Error: %v\n", err)
+		exit(exitError)
+	}
+
+	// Parse the start and end times
+	var startTime, endTime time.Time
+	now := time.Now()
+	if *startTimeStr != "" {
+		startTime, err = parseTimeSpec(*startTimeStr, now)
+		if err != nil {
+			logErrorf("Error parsing start time: %v\n", err)
+			exit(exitError)
+		}
+	}
+	if *endTimeStr != "" {
+		endTime, err = parseTimeSpec(*endTimeStr, now)
+		if err != nil {
+			logErrorf("Error parsing end time: %v\n", err)
+			exit(exitError)
+		}
+		endTime = endTime.Add(1 * time.Second)
+	}
+	// compared with -end as given, before the second added above
+	if !startTime.IsZero() && !endTime.IsZero() && startTime.After(endTime.Add(-time.Second)) {
+		logErrorf("Error: the start time %s is after the end time %s\n",
+			startTime.Format(time.RFC3339), endTime.Add(-time.Second).Format(time.RFC3339))
+		exit(exitError)
+	}
+
+	// Get the remaining arguments (file patterns)
+	files := flag.Args()
+	if len(files) == 0 {
+		_, _ = flag.CommandLine.Output().Write([]byte("No files specified\nUsage: logmerge [switches] <file1|@filelist> <file2> ... <fileN>\nSwitches:\n"))
+		flag.PrintDefaults()
+		//fmt.Println("Usage: logmerge [-v] [-sep FIELD_SEPARATOR] [-start START_TIME] [-end END_TIME] <file1> <file2> ... <fileN>")
+		exit(exitError)
+	}
+
+	profilingStart := time.Now()
+
+	args, err := expandFileLists(files, *nullSeparated)
+	if err != nil {
+		logErrorf("Error reading file list: %s\n", err)
+		exit(exitError)
+	}
+	var allFiles []string
+	unmatched := 0
+	stdinUsed := false
+	for _, arg := range args {
+		if arg.name == stdinArg {
+			if stdinUsed {
+				logErrorf("Standard input (%s) can only be given once\n", stdinArg)
+				exit(exitError)
+			}
+			stdinUsed = true
+			allFiles = append(allFiles, arg.name)
+			continue
+		}
+		if arg.literal || isURL(arg.name) {
+			allFiles = append(allFiles, arg.name)
+			continue
+		}
+		matches, err := expandGlob(arg.name, *skipHidden)
+		var skipped []string
+		if err == nil {
+			matches, skipped, err = expandDirectories(matches, *recursive, *skipHidden)
+		}
+		if err != nil {
+			logFileErrorf("Error expanding glob pattern %s: %s\n", arg.name, err)
+			unmatched++
+			continue
+		}
+		if len(skipped) > 0 && *verbose {
+			PrintfStderr("Skipped directories (see -recursive): %s\n", strings.Join(skipped, ", "))
+		}
+		if len(matches) == 0 && len(skipped) > 0 {
+			logFileErrorf("Only directories match %s, see -recursive\n", arg.name)
+			unmatched++
+			continue
+		}
+		if len(matches) == 0 {
+			logFileErrorf("No files match the pattern: %s\n", arg.name)
+			unmatched++
+			continue
+		}
+		allFiles = append(allFiles, matches...)
+	}
+	if len(excludeFiles) > 0 {
+		var excluded int
+		allFiles, excluded = excludeFiles.filter(allFiles)
+		if *verbose {
+			PrintfStderr("Excluded %d files\n", excluded)
+		}
+	}
+	if *fnameDate != "" {
+		re, err := regexp.Compile(*fnameDate)
+		if err != nil {
+			logErrorf("Error: -fname-date: %v\n", err)
+			exit(exitError)
+		}
+		var skipped []string
+		allFiles, skipped = fileDate{re: re, layout: *fnameLayout, location: location}.filter(allFiles, startTime, endTime)
+		if *verbose && len(skipped) > 0 {
+			PrintfStderr("Skipped %d files dated outside the time range: %s\n", len(skipped), strings.Join(skipped, "\n   "))
+		}
+	}
+	if !*allowDupes {
+		var dropped int
+		allFiles, dropped = uniqueFiles(allFiles)
+		if dropped > 0 && *verbose {
+			PrintfStderr("Dropped %d files given more than once\n", dropped)
+		}
+	}
+	if *rotation {
+		allFiles = orderRotations(allFiles)
+	}
+	// the files in tar archives count as files for -max-open; a followed
+	// file is never read as an archive
+	var archives *archiveEntries
+	if !*follow {
+		var failed int
+		allFiles, archives, failed = expandArchives(allFiles)
+		unmatched += failed
+		atExit(archives.Remove)
+	}
+	if *verbose {
+		PrintfStderr("Start time: %s\n", startTime.Format("2006-01-02 15:04:05"))
+		PrintfStderr("End time: %s\n", endTime.Format("2006-01-02 15:04:05"))
+		PrintfStderr("Files: %s\n", strings.Join(allFiles, "\n   "))
+		if *follow {
+			PrintfStderr("Follow mode: a line is only printed once every followed file has a line at least as recent,\n" +
+				"   so output is strictly ordered but waits for the quietest file. Standard input is not followed.\n")
+		}
+	}
+
+	// The first SIGINT or SIGTERM stops the merge, the output so far is still
+	// written. A second one terminates right away.
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		cancel()
+	}()
+	// Writing to a closed pipe, e.g. to head, fails with EPIPE instead of
+	// killing the process, so that the merge ends like with -head.
+	signal.Ignore(syscall.SIGPIPE)
+	// mergeCtx also ends the merge once -head lines are output
+	mergeCtx, stopMerge := context.WithCancel(ctx)
+	defer stopMerge()
+
+	opts := logmerge.Options{
+		StartTime:     startTime,
+		EndTime:       endTime,
+		Separator:     separator,
+		Verbose:       *verbose,
+		Multiline:     *multiline,
+		MaxLineLength: *maxLine,
+		Preamble:      *preamble,
+
+		RequireTimestamps: *requireTimestamps,
+		SkipBinary:        *skipBinary,
+
+		Include:   include,
+		Exclude:   exclude,
+		Location:  location,
+		Patterns:  patterns,
+		DateOrder: logmerge.DateOrder(*dateOrder),
+
+		ZoneAbbreviations: tzAbbreviations,
+
+		TimestampFrom: tsFrom,
+		TimestampTo:   tsTo,
+
+		Buffer: *buffer,
+		Logger: logger,
+	}
+
+	if *dryRunFlag {
+		if dryRun(ctx, os.Stdout, allFiles, archives, opts, fileTZ, *verbose) > 0 || unmatched > 0 {
+			exit(exitError)
+		}
+		exit(0)
+	}
+	if *summary {
+		names, stats, failed, err := summarize(ctx, allFiles, archives, *maxOpen, opts, fileTZ)
+		if err != nil {
+			logWarnf("Interrupted, no summary was written\n")
+			exit(exitInterrupted)
+		}
+		printFileStats(os.Stdout, names, stats)
+		if len(names) == 0 {
+			logErrorf("No file could be read\n")
+			exit(exitError)
+		}
+		if *strict && unmatched+failed > 0 {
+			logErrorf("Not all files could be opened\n")
+			exit(exitError)
+		}
+		exit(0)
+	}
+
+	if *showProgress && (isTerminal(os.Stderr) || *verbose) {
+		readProgress = newProgress(allFiles, archives, os.Stderr, isTerminal(os.Stderr))
+		readProgress.start()
+	}
+
+	// With more than -max-open files, they are merged batch-wise into
+	// temporary files first, so they need not all be open at once.
+	var in *inputs
+	var pre *premerged
+	failed := 0
+	if *maxOpen > 0 && len(allFiles) > *maxOpen {
+		if *follow {
+			logErrorf("Cannot follow more than %d files, see -max-open\n", *maxOpen)
+			exit(exitError)
+		}
+		if *verbose {
+			PrintfStderr("Merging %d files in batches of %d\n", len(allFiles), *maxOpen)
+		}
+		pre, err = premerge(ctx, allFiles, archives, *maxOpen, opts, fileTZ)
+		if errors.Is(err, context.Canceled) {
+			logWarnf("Interrupted, no output was written\n")
+			exit(exitInterrupted)
+		}
+		if err != nil {
+			logErrorf("Error merging batches of files: %v\n", err)
+			exit(exitError)
+		}
+		failed = pre.failed
+		atExit(pre.Close)
+	} else {
+		in = openInputs(mergeCtx, allFiles, archives, *follow)
+		failed = in.failed
+		atExit(in.Close)
+	}
+	if *strict && unmatched+failed > 0 {
+		logErrorf("Not all files could be opened\n")
+		exit(exitError)
+	}
+
+	// stdout is flushed when the buffer is full and as stdoutFlusher decides
+	stdout := bufio.NewWriter(os.Stdout)
+	flusher := newStdoutFlusher(stdout, *follow)
+	var w io.Writer = stdout
+	useColor := color.enabled(os.Stdout)
+	var outFile *outputFile
+	if *outPath != "" {
+		outFile, err = createOutputFile(*outPath)
+		if err != nil {
+			logErrorf("Error creating output file: %v\n", err)
+			exit(exitError)
+		}
+		w = outFile
+		useColor = color.enabled(outFile.f)
+	}
+	var colors map[level]int
+	if color == colorLevel && useColor {
+		colors, err = levelColors(os.Getenv(levelColorsEnv))
+		if err != nil {
+			outFile.Abort()
+			logErrorf("Error: %v\n", err)
+			exit(exitError)
+		}
+		useColor = false
+	}
+	outOpts := outputOptions{
+		separator:     separator,
+		separator1:    separator1,
+		separator2:    separator2,
+		timeLayout:    *outputLayout,
+		keepTimestamp: *keepTimestamp,
+		keepInMessage: *keepInMessage,
+		csvHeader:     *csvHeader,
+		template:      *tmpl,
+		delta:         *delta,
+		lineNo:        *lineNo,
+		noFilename:    *noFilename,
+		inlineOrphans: *orphanLines == "inline",
+		markers:       *markers,
+		markerFormat:  *markerFormat,
+		color:         useColor,
+		levelColors:   colors,
+		nameLen:       *nameLen,
+	}
+	out, err := newLineWriter(*outputFormat, w, outOpts)
+	if err != nil {
+		outFile.Abort()
+		logErrorf("Error: %v\n", err)
+		exit(exitError)
+	}
+	var counter *lineCounter
+	if count != countOff {
+		counter = &lineCounter{perFile: map[string]int{}}
+		out = counter
+	}
+	teeOut, err := openTees(teeLevels, *outputFormat, outOpts)
+	if err != nil {
+		outFile.Abort()
+		logErrorf("Error creating -tee-level file: %v\n", err)
+		exit(exitError)
+	}
+	// abortOutput discards -out and the tees, but keeps what was written to
+	// stdout
+	abortOutput := func() {
+		_ = stdout.Flush()
+		outFile.Abort()
+		teeOut.Abort()
+	}
+
+	stats := &logmerge.Stats{}
+	var names []string
+	var ch <-chan logmerge.Line
+	if pre != nil {
+		*stats = pre.stats
+		names = pre.names
+		ch = pre.Merge(mergeCtx)
+	} else {
+		names = in.names
+		opts.ModTimes, opts.Stats = in.modTimes, stats
+		opts.Locations = fileTZ.locations(in.names)
+		ch, err = logmerge.MergeSources(mergeCtx, in.sources(), opts)
+		if err != nil {
+			abortOutput()
+			logErrorf("Error: %v\n", err)
+			exit(exitError)
+		}
+	}
+
+	var labels map[string]string
+	if *index && !*noFilename {
+		labels = indexLabels(allFiles, *outputFormat == "text" && *tmpl == "")
+		for i, file := range allFiles {
+			if file == stdinArg {
+				file = stdinName
+			}
+			PrintfStderr("[%d] %s\n", i, file)
+		}
+	}
+
+	// stdoutClosed is set once the reader of stdout went away
+	stdoutClosed := false
+	writeLine := func(line logmerge.Line) {
+		if labels != nil {
+			line.Filename = indexLabel(labels, line.Filename)
+		}
+		err := out.WriteLine(line)
+		if outFile == nil && errors.Is(err, syscall.EPIPE) {
+			stdoutClosed = true
+			return
+		}
+		if err == nil {
+			err = teeOut.WriteLine(line)
+		}
+		if err != nil {
+			abortOutput()
+			logErrorf("Error writing output: %s\n", err)
+			exit(exitError)
+		}
+	}
+	// checkFlush handles an error of flushing stdout
+	checkFlush := func(err error) {
+		if errors.Is(err, syscall.EPIPE) {
+			stdoutClosed = true
+		} else if err != nil {
+			abortOutput()
+			logErrorf("Error writing output: %s\n", err)
+			exit(exitError)
+		}
+	}
+	outputLines, duplicates := 0, 0
+	var previous logmerge.Line
+	// with -reverse, the first lines of the output are the last ones merged,
+	// so -head keeps the last lines like -tail and -tail stops the merge
+	firstLines, lastLines := *headLines, *tailLines
+	if *reverse {
+		firstLines, lastLines = lastLines, firstLines
+	}
+	// the last lines in a ring buffer, the oldest at tailNext, or with
+	// -reverse otherwise all lines
+	var tail []logmerge.Line
+	tailNext := 0
+	// emit passes a line on to -sample, -tail or -head and the output, and
+	// reports whether no more lines are wanted
+	emit := func(line logmerge.Line) bool {
+		if sampling != nil && !sampling.keep(line.Filename) {
+			return false
+		}
+		outputLines++
+		if lastLines > 0 {
+			if len(tail) < lastLines {
+				tail = append(tail, line)
+			} else {
+				tail[tailNext] = line
+				tailNext = (tailNext + 1) % lastLines
+			}
+			return false
+		}
+		if *reverse {
+			tail = append(tail, line)
+			return outputLines == firstLines
+		}
+		writeLine(line)
+		return outputLines == firstLines || stdoutClosed
+	}
+	done := false
+	// output emits line, and ends the merge if no more lines are wanted
+	output := func(line logmerge.Line) {
+		stop := emit(line)
+		checkFlush(flusher.lineWritten(len(ch) == 0))
+		stop = stop || stdoutClosed
+		if stop {
+			// let the merge end and fill in the stats
+			done = true
+			stopMerge()
+			for range ch {
+			}
+		}
+	}
+	// with -f, the run held by -coalesce is output once the merge went quiet
+	// for flushInterval, instead of when the next line arrives
+	var runDue <-chan time.Time
+	for {
+		var line logmerge.Line
+		var ok bool
+		select {
+		case line, ok = <-ch:
+		case <-flusher.due():
+			// the merge went quiet, e.g. waiting for a pipe
+			checkFlush(flusher.Flush())
+			continue
+		case <-runDue:
+			runDue = nil
+			if line, ok := coalescing.flush(); ok {
+				output(line)
+			}
+			continue
+		}
+		if !ok {
+			break
+		}
+		if line.Orphan && *orphanLines == "drop" {
+			continue
+		}
+		if *utc {
+			line.Timestamp = line.Timestamp.UTC()
+		}
+		if *sanitize {
+			line.RestOfLine = strings.ToValidUTF8(line.RestOfLine, "\uFFFD")
+		}
+		if threshold != levelUnknown {
+			if l := lineLevel(line); l == levelUnknown && *unknownLevels == "drop" || l != levelUnknown && l < threshold {
+				continue
+			}
+		}
+		if *dedup && outputLines > 0 && isDuplicate(line, previous, *dedupScope == "file") {
+			duplicates++
+			continue
+		}
+		previous = line
+		if recent != nil && recent.seen(line) {
+			continue
+		}
+		if coalescing != nil {
+			if *follow {
+				runDue = time.After(flushInterval)
+			}
+			var ok bool
+			if line, ok = coalescing.add(line); !ok {
+				continue
+			}
+		}
+		output(line)
+		if done {
+			runDue = nil
+		}
+	}
+	if coalescing != nil && !done {
+		if line, ok := coalescing.flush(); ok {
+			emit(line)
+		}
+	}
+	tail = append(tail[tailNext:], tail[:tailNext]...)
+	if *reverse {
+		slices.Reverse(tail)
+	}
+	for _, line := range tail {
+		writeLine(line)
+		if stdoutClosed {
+			break
+		}
+	}
+	if counter != nil && !stdoutClosed {
+		err := counter.write(w, names, labels, count == countByFile)
+		if err != nil && (outFile != nil || !errors.Is(err, syscall.EPIPE)) {
+			abortOutput()
+			logErrorf("Error writing output: %s\n", err)
+			exit(exitError)
+		}
+	}
+	checkFlush(flusher.Flush())
+	readProgress.Stop()
+	in.Close()
+	if err := pre.Err(); err != nil && ctx.Err() == nil {
+		abortOutput()
+		logErrorf("Error reading merged batch: %s\n", err)
+		exit(exitError)
+	}
+	pre.Close()
+	if *verbose {
+		printFileStats(os.Stderr, names, stats)
+		PrintfStderr("Lines: %d\n", stats.Lines)
+		PrintfStderr("Cache hits: %d, misses: %d\n", stats.CacheHits, stats.CacheMisses)
+		if *dedup {
+			PrintfStderr("Duplicates dropped: %d\n", duplicates)
+		}
+		if recent != nil {
+			PrintfStderr("Equal lines dropped: %d\n", recent.suppressed)
+		}
+		if coalescing != nil {
+			PrintfStderr("Coalesced: %d lines\n", coalescing.coalesced)
+		}
+		if sampling != nil {
+			PrintfStderr("Sampled 1/%d: %d of %d lines\n", sampling.n, sampling.kept, sampling.seen)
+		}
+		PrintfStderr("Duration %s\n", time.Since(profilingStart))
+	}
+
+	readable := 0
+	for _, err := range stats.Errors {
+		if err == nil || errors.Is(err, context.Canceled) {
+			readable++
+		}
+	}
+	if readable == 0 {
+		abortOutput()
+		logErrorf("No file could be read\n")
+		exit(exitError)
+	}
+	if err := errors.Join(outFile.Close(), teeOut.Close()); err != nil {
+		logErrorf("Error writing output: %s\n", err)
+		exit(exitError)
+	}
+	if ctx.Err() != nil {
+		logWarnf("Interrupted, the output is incomplete\n")
+		exit(exitInterrupted)
+	}
+	if outputLines == 0 {
+		exit(exitNoLines)
+	}
+	exit(0)
+}
+
+// printFileStats prints a table of the per file stats to w.
+func printFileStats(w io.Writer, names []string, stats *logmerge.Stats) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "File\tLines\tNo timestamp\tFirst\tLast\tEnd")
+	for i, name := range names {
+		if i >= len(stats.Files) {
+			break
+		}
+		file := stats.Files[i]
+		first, last := "-", "-"
+		if !file.First.IsZero() {
+			first = file.First.Format(time.RFC3339Nano)
+			last = file.Last.Format(time.RFC3339Nano)
+		}
+		end := "ok"
+		if i < len(stats.Errors) && stats.Errors[i] != nil {
+			end = "error: " + stats.Errors[i].Error()
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\n", name, file.Lines, file.NoTimestamp, first, last, end)
+	}
+	_ = tw.Flush()
+}
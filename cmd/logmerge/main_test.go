@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnescapeSeparator(t *testing.T) {
+	tests := []struct {
+		value, want string
+		fails       bool
+	}{
+		{" ", " ", false},
+		{"", "", false},
+		{" | ", " | ", false},
+		{`\t`, "\t", false},
+		{`\n`, "\n", false},
+		{`\r\n`, "\r\n", false},
+		{`\0`, "\x00", false},
+		{`\\`, `\`, false},
+		{`a\tb\\c`, "a\tb\\c", false},
+		{`\\t`, `\t`, false},
+		{`\`, "", true},
+		{`a\`, "", true},
+		{`\x`, "", true},
+		{`\u0009`, "", true},
+	}
+	for _, tt := range tests {
+		got, err := unescapeSeparator(tt.value)
+		if (err != nil) != tt.fails || got != tt.want {
+			t.Errorf("%q: got %q, %v, want %q, error %v", tt.value, got, err, tt.want, tt.fails)
+		}
+	}
+}
+
+// runArgsEnv makes the test binary run main with the arguments in it, one
+// per line, see runLogmerge.
+const runArgsEnv = "LOGMERGE_TEST_ARGS"
+
+func TestMain(m *testing.M) {
+	if args, found := os.LookupEnv(runArgsEnv); found {
+		os.Args = append([]string{"logmerge"}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// logmergeCmd returns the command that runs logmerge with args in a new
+// process, as main exits.
+func logmergeCmd(t *testing.T, args ...string) *exec.Cmd {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	cmd := exec.Command(exe)
+	cmd.Env = append(os.Environ(), runArgsEnv+"="+strings.Join(args, "\n"))
+	return cmd
+}
+
+// writeLog writes lines lines with increasing timestamps to a new file in
+// dir and returns its path.
+func writeLog(t *testing.T, dir, name string, lines int) string {
+	t.Helper()
+	var b strings.Builder
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&b, "2025-06-10 14:%02d:%02d.%03d line %d of %s\n", i/60000%60, i/1000%60, i%1000, i, name)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestClosedStdout(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{writeLog(t, dir, "a.log", 50000), writeLog(t, dir, "b.log", 50000)}
+	for _, tt := range []struct {
+		name      string
+		args      []string
+		readFirst bool // read a line before closing the pipe
+	}{
+		{"after a line", files, true},
+		{"before the output", files, false},
+		{"tail", append([]string{"-tail", "60000"}, files...), false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd := logmergeCmd(t, tt.args...)
+			var stderr bytes.Buffer
+			cmd.Stdout, cmd.Stderr = w, &stderr
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			w.Close()
+			if tt.readFirst {
+				if _, err := bufio.NewReader(r).ReadString('\n'); err != nil {
+					t.Fatal(err)
+				}
+			}
+			r.Close()
+			err = cmd.Wait()
+			if err != nil || stderr.Len() > 0 {
+				t.Errorf("got %v, stderr %q, want exit code 0 without errors", err, stderr.String())
+			}
+		})
+	}
+}
+
+func TestDayFirst(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.log")
+	b := filepath.Join(dir, "b.log")
+	if err := os.WriteFile(a, []byte("10/06/2025 14:30:00 a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("2025-07-01 00:00:00 b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dayFirst := "2025-06-10 14:30:00 a.log a\n2025-07-01 00:00:00 b.log b\n"
+	monthFirst := "2025-07-01 00:00:00 b.log b\n2025-10-06 14:30:00 a.log a\n"
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-day-first"}, dayFirst},
+		{[]string{"-date-order=dmy"}, dayFirst},
+		// the later flag wins
+		{[]string{"-date-order=mdy", "-day-first"}, dayFirst},
+		{[]string{"-day-first", "-date-order=mdy"}, monthFirst},
+		// without a date order, a is not read
+		{[]string{"-day-first=false"}, "2025-07-01 00:00:00 b.log b\n"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			cmd := logmergeCmd(t, append(tt.args, a, b)...)
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("%v: %s", err, stderr.String())
+			}
+			if string(out) != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeparators(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.log")
+	if err := os.WriteFile(file, []byte("2025-06-10 14:30:00 hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "2025-06-10 14:30:00 a.log hello\n"},
+		{[]string{"-sep", `\t`}, "2025-06-10 14:30:00\ta.log\thello\n"},
+		{[]string{"-sep1", "|"}, "2025-06-10 14:30:00|a.log hello\n"},
+		{[]string{"-sep2", `\t`}, "2025-06-10 14:30:00 a.log\thello\n"},
+		{[]string{"-sep1", " ", "-sep2", `\t`}, "2025-06-10 14:30:00 a.log\thello\n"},
+		{[]string{"-sep", ";", "-sep1", " | "}, "2025-06-10 14:30:00 | a.log;hello\n"},
+		// -sep stays between the filename and the line number
+		{[]string{"-sep", "|", "-sep2", `\t`, "-lineno"}, "2025-06-10 14:30:00|a.log|1\thello\n"},
+		{[]string{"-sep1", "|", "-sep2", `\t`, "-lineno", "-no-filename"}, "2025-06-10 14:30:00|1\thello\n"},
+		{[]string{"-sep1", "|", "-sep2", `\t`, "-no-filename"}, "2025-06-10 14:30:00|hello\n"},
+		// the original line has no timestamp column
+		{[]string{"-sep1", "|", "-sep2", `\t`, "-keep-ts"}, "a.log\t2025-06-10 14:30:00 hello\n"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			cmd := logmergeCmd(t, append(tt.args, file)...)
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("%v: %s", err, stderr.String())
+			}
+			if string(out) != tt.want {
+				t.Errorf("got %q, want %q", out, tt.want)
+			}
+		})
+	}
+	for _, flag := range []string{"-sep", "-sep1", "-sep2"} {
+		cmd := logmergeCmd(t, flag, `\q`, file)
+		if out, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(out), "Error: "+flag+":") {
+			t.Errorf("%s \\q: %v, output %q, want its error", flag, err, out)
+		}
+	}
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/100days/logmerge"
+)
+
+// lineWriter renders merged lines in one of the supported output formats.
+type lineWriter interface {
+	WriteLine(line logmerge.Line) error
+}
+
+// outputOptions holds the command line settings of the lineWriters.
+type outputOptions struct {
+	separator     string
+	separator1    string // after the timestamp of the text output, default separator
+	separator2    string // after its filename and line number, before the message, default separator
+	timeLayout    string
+	keepTimestamp bool          // print the original line instead of a reformatted timestamp
+	keepInMessage bool          // see message
+	csvHeader     bool          // start the CSV output with a header row
+	template      string        // -template, which replaces format
+	color         bool          // color the filename column
+	levelColors   map[level]int // if not nil, color lines by their level
+	nameLen       int           // see fileColumn
+	delta         bool          // start the text output with the time since the previous line
+	lineNo        bool          // add the line number in the file after the file
+	noFilename    bool          // omit the filename, in all formats but -template
+	inlineOrphans bool          // write lines without timestamp as they are, without any columns
+	markers       bool          // write a marker line between lines of different files
+	markerFormat  string        // the marker line, see markerFile
+}
+
+// markerFile is the placeholder of the filename in -marker-format.
+const markerFile = "{file}"
+
+// message returns the text of line for the output, the original line with
+// keepInMessage.
+func message(line logmerge.Line, keepInMessage bool) string {
+	if keepInMessage {
+		return line.OriginalLine()
+	}
+	return line.Message()
+}
+
+// fileColumn returns the filename column of the text output: the full path
+// if nameLen is 0, the base name if it is negative, otherwise the last
+// nameLen characters of the base name.
+func fileColumn(filename string, nameLen int) string {
+	if nameLen == 0 {
+		return filename
+	}
+	base := baseName(filename)
+	if nameLen > 0 && len(base) > nameLen {
+		return base[len(base)-nameLen:]
+	}
+	return base
+}
+
+// indexLabels maps the names of files, as reported in logmerge.Line, to their
+// zero-based position in files for -index: [3] in the text output, 3 in the
+// other formats. A file given more than once gets its first position.
+func indexLabels(files []string, brackets bool) map[string]string {
+	labels := make(map[string]string, len(files))
+	for i, file := range files {
+		if file == stdinArg {
+			file = stdinName
+		}
+		if _, found := labels[file]; found {
+			continue
+		}
+		labels[file] = strconv.Itoa(i)
+		if brackets {
+			labels[file] = "[" + labels[file] + "]"
+		}
+	}
+	return labels
+}
+
+// indexLabel returns the label of the file name in labels, for a file in a
+// tar archive that of the archive.
+func indexLabel(labels map[string]string, name string) string {
+	if label, found := labels[name]; found {
+		return label
+	}
+	for archive, label := range labels {
+		if strings.HasPrefix(name, archive+archiveSeparator) {
+			labels[name] = label
+			return label
+		}
+	}
+	return name
+}
+
+// textWriter writes the classic "timestamp sep filename sep line" layout.
+type textWriter struct {
+	w io.Writer
+	outputOptions
+	previous *time.Time // timestamp of the previous line, for delta
+	file     *string    // file of the previous line, for markers
+}
+
+func (t *textWriter) WriteLine(line logmerge.Line) error {
+	if t.markers {
+		if err := t.writeMarker(line.Filename); err != nil {
+			return err
+		}
+	}
+	// the filename column with its separator after it
+	var filenamePrefix string
+	if !t.noFilename {
+		filenamePrefix = fileColumn(line.Filename, t.nameLen)
+		if t.color {
+			filenamePrefix = colorize(filenamePrefix, fileColor(line.Filename))
+		}
+	}
+	if t.inlineOrphans && line.Orphan {
+		_, err := fmt.Fprintf(t.w, "%s\n", line.RestOfLine)
+		return err
+	}
+	end := "\n"
+	if t.levelColors != nil {
+		if color := t.levelColors[lineLevel(line)]; color != 0 {
+			if _, err := fmt.Fprintf(t.w, "\x1b[%dm", color); err != nil {
+				return err
+			}
+			end = "\x1b[0m\n"
+		}
+	}
+	if t.delta {
+		if _, err := fmt.Fprintf(t.w, "%s%s", formatDelta(line.Timestamp, t.previous), t.separator); err != nil {
+			return err
+		}
+		t.previous = &line.Timestamp
+	}
+	if t.lineNo {
+		if !t.noFilename {
+			filenamePrefix += t.separator
+		}
+		filenamePrefix += strconv.Itoa(line.LineNo)
+	}
+	if !t.noFilename || t.lineNo {
+		filenamePrefix += t.separator2
+	}
+	if t.keepTimestamp {
+		_, err := fmt.Fprintf(t.w, "%s%s%s", filenamePrefix, line.OriginalLine(), end)
+		return err
+	}
+	_, err := fmt.Fprintf(t.w, "%s%s%s%s%s", line.Timestamp.Format(t.timeLayout), t.separator1, filenamePrefix, message(line, t.keepInMessage), end)
+	return err
+}
+
+// writeMarker writes the marker line of markerFormat if file is not that of the previous
+// line, with its base name, or the full path if nameLen is 0.
+func (t *textWriter) writeMarker(file string) error {
+	previous := t.file
+	t.file = &file
+	if previous == nil || *previous == file {
+		return nil
+	}
+	name := file
+	if t.nameLen != 0 {
+		name = baseName(file)
+	}
+	marker := strings.ReplaceAll(t.markerFormat, markerFile, name)
+	if t.color {
+		marker = colorize(marker, fileColor(file))
+	}
+	_, err := fmt.Fprintf(t.w, "%s\n", marker)
+	return err
+}
+
+// formatDelta formats the time from previous to timestamp in seconds, like
+// +0.123s, or +0 without previous.
+func formatDelta(timestamp time.Time, previous *time.Time) string {
+	if previous == nil {
+		return "+0"
+	}
+	return fmt.Sprintf("%+.3fs", timestamp.Sub(*previous).Seconds())
+}
+
+// jsonWriter writes one JSON object per line (JSON Lines).
+type jsonWriter struct {
+	enc           *json.Encoder
+	keepInMessage bool
+	lineNo        bool
+	noFilename    bool
+}
+
+type jsonLine struct {
+	Timestamp string `json:"timestamp"`
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Message   string `json:"message"`
+}
+
+func newJSONWriter(w io.Writer, keepInMessage, lineNo, noFilename bool) *jsonWriter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &jsonWriter{enc: enc, keepInMessage: keepInMessage, lineNo: lineNo, noFilename: noFilename}
+}
+
+func (j *jsonWriter) WriteLine(line logmerge.Line) error {
+	out := jsonLine{
+		Timestamp: line.Timestamp.Format(time.RFC3339),
+		File:      line.Filename,
+		Message:   message(line, j.keepInMessage),
+	}
+	if j.lineNo {
+		out.Line = line.LineNo
+	}
+	if j.noFilename {
+		out.File = ""
+	}
+	return j.enc.Encode(out)
+}
+
+// logfmtWriter writes one "time=... file=... msg=..." line per line.
+type logfmtWriter struct {
+	w             io.Writer
+	timeLayout    string
+	keepInMessage bool
+	lineNo        bool
+	noFilename    bool
+}
+
+func (l *logfmtWriter) WriteLine(line logmerge.Line) error {
+	fileFields := ""
+	if !l.noFilename {
+		fileFields = " file=" + logfmtValue(line.Filename)
+	}
+	if l.lineNo {
+		fileFields += " line=" + strconv.Itoa(line.LineNo)
+	}
+	_, err := fmt.Fprintf(l.w, "time=%s%s msg=%s\n",
+		logfmtValue(line.Timestamp.Format(l.timeLayout)), fileFields, logfmtValue(message(line, l.keepInMessage)))
+	return err
+}
+
+// logfmtValue quotes value if it is empty or contains spaces, quotes, = or
+// non-printable characters.
+func logfmtValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\\") || strings.ContainsFunc(value, func(r rune) bool {
+		return !unicode.IsPrint(r)
+	}) {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// csvWriter writes timestamp,file,message records.
+type csvWriter struct {
+	w             *csv.Writer
+	timeLayout    string
+	keepInMessage bool
+	lineNo        bool
+	noFilename    bool
+	header        bool // the header row is still to be written
+}
+
+func (c *csvWriter) WriteLine(line logmerge.Line) error {
+	if c.header {
+		c.header = false
+		header := []string{"timestamp"}
+		if !c.noFilename {
+			header = append(header, "file")
+		}
+		if c.lineNo {
+			header = append(header, "line")
+		}
+		if err := c.w.Write(append(header, "message")); err != nil {
+			return err
+		}
+	}
+	record := []string{line.Timestamp.Format(c.timeLayout)}
+	if !c.noFilename {
+		record = append(record, line.Filename)
+	}
+	if c.lineNo {
+		record = append(record, strconv.Itoa(line.LineNo))
+	}
+	if err := c.w.Write(append(record, message(line, c.keepInMessage))); err != nil {
+		return err
+	}
+	// flush every record, e.g. for -f
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// templateWriter executes a -template per line.
+type templateWriter struct {
+	w             io.Writer
+	tmpl          *template.Template
+	keepInMessage bool
+}
+
+// templateLine is the data of a -template.
+type templateLine struct {
+	Timestamp time.Time
+	File      string
+	Message   string
+	LineNo    int // in File
+}
+
+// templateFuncs are the functions available in a -template.
+var templateFuncs = template.FuncMap{
+	// format formats a time with a Go time layout: {{format "15:04:05.000" .Timestamp}}
+	"format": func(layout string, t time.Time) string { return t.Format(layout) },
+	// ago is the time since t in whole seconds: {{ago .Timestamp}}
+	"ago": func(t time.Time) string { return time.Since(t).Round(time.Second).String() },
+	// base is the last element of a path: {{base .File}}
+	"base": filepath.Base,
+}
+
+// newTemplateWriter parses text, to be written followed by a newline per line.
+func newTemplateWriter(w io.Writer, text string, keepInMessage bool) (*templateWriter, error) {
+	tmpl, err := template.New("line").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &templateWriter{w: w, tmpl: tmpl, keepInMessage: keepInMessage}, nil
+}
+
+func (t *templateWriter) WriteLine(line logmerge.Line) error {
+	if err := t.tmpl.Execute(t.w, templateLine{
+		Timestamp: line.Timestamp,
+		File:      line.Filename,
+		Message:   message(line, t.keepInMessage),
+		LineNo:    line.LineNo,
+	}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(t.w, "\n")
+	return err
+}
+
+// lineCounter counts the output lines per file for -count, instead of
+// writing them.
+type lineCounter struct {
+	perFile map[string]int
+	total   int
+}
+
+func (c *lineCounter) WriteLine(line logmerge.Line) error {
+	c.perFile[line.Filename]++
+	c.total++
+	return nil
+}
+
+// write writes the total to w, with byFile after a line per file of names,
+// with its label if labels is not nil, like wc -l.
+func (c *lineCounter) write(w io.Writer, names []string, labels map[string]string, byFile bool) error {
+	if !byFile {
+		_, err := fmt.Fprintf(w, "%d\n", c.total)
+		return err
+	}
+	written := map[string]bool{}
+	for _, name := range names {
+		if labels != nil {
+			name = indexLabel(labels, name)
+		}
+		if written[name] {
+			continue
+		}
+		written[name] = true
+		if _, err := fmt.Fprintf(w, "%d %s\n", c.perFile[name], name); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d total\n", c.total)
+	return err
+}
+
+// defaultOutputLayout is the timestamp layout of the text output.
+const defaultOutputLayout = "2006-01-02 15:04:05"
+
+// newLineWriter returns the lineWriter for the given -format value.
+func newLineWriter(format string, w io.Writer, opts outputOptions) (lineWriter, error) {
+	if opts.template != "" {
+		return newTemplateWriter(w, opts.template, opts.keepInMessage)
+	}
+	switch format {
+	case "text":
+		return &textWriter{w: w, outputOptions: opts}, nil
+	case "json":
+		return newJSONWriter(w, opts.keepInMessage, opts.lineNo, opts.noFilename), nil
+	case "logfmt":
+		layout := opts.timeLayout
+		if layout == defaultOutputLayout {
+			layout = time.RFC3339
+		}
+		return &logfmtWriter{w: w, timeLayout: layout, keepInMessage: opts.keepInMessage, lineNo: opts.lineNo, noFilename: opts.noFilename}, nil
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(w), timeLayout: opts.timeLayout, keepInMessage: opts.keepInMessage, lineNo: opts.lineNo, noFilename: opts.noFilename, header: opts.csvHeader}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+// outputFile is the -out file. It is written buffered to a temporary file
+// next to path, which replaces path on Close, so the output appears
+// atomically. With a .gz suffix the output is gzip-compressed.
+type outputFile struct {
+	f    *os.File
+	path string
+	buf  *bufio.Writer
+	gz   *gzip.Writer
+}
+
+func createOutputFile(path string) (*outputFile, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(0644); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	o := &outputFile{f: f, path: path}
+	var w io.Writer = f
+	if strings.HasSuffix(path, ".gz") {
+		o.gz = gzip.NewWriter(f)
+		w = o.gz
+	}
+	o.buf = bufio.NewWriter(w)
+	return o, nil
+}
+
+func (o *outputFile) Write(p []byte) (int, error) {
+	return o.buf.Write(p)
+}
+
+// Close flushes all output and moves the file to its final path. It does
+// nothing on a nil outputFile.
+func (o *outputFile) Close() error {
+	if o == nil {
+		return nil
+	}
+	err := o.buf.Flush()
+	if o.gz != nil && err == nil {
+		err = o.gz.Close()
+	}
+	if closeErr := o.f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(o.f.Name(), o.path)
+	}
+	if err != nil {
+		_ = os.Remove(o.f.Name())
+	}
+	return err
+}
+
+// Abort discards the output, leaving an existing file at path untouched. It
+// does nothing on a nil outputFile.
+func (o *outputFile) Abort() {
+	if o == nil {
+		return
+	}
+	_ = o.f.Close()
+	_ = os.Remove(o.f.Name())
+}
+
+// flushInterval is how long merged output may wait in the stdout buffer
+// while no merged line is waiting, without -f.
+const flushInterval = 200 * time.Millisecond
+
+// stdoutFlusher decides when the buffered stdout is flushed. Lines that are
+// merged faster than they are written go out whenever the buffer is full.
+// Once no merged line is waiting, the output is flushed right away with -f,
+// as the next line may take long, and otherwise at most every
+// flushInterval, so that a merge of few lines at a time, e.g. with
+// -buffer 0, does not write every line on its own. If no further line is
+// merged meanwhile, the channel of due tells when flushInterval is over.
+type stdoutFlusher struct {
+	w      *bufio.Writer
+	follow bool
+	now    func() time.Time
+	last   time.Time   // of the last flush
+	timer  *time.Timer // set while output waits for flushInterval to pass
+}
+
+func newStdoutFlusher(w *bufio.Writer, follow bool) *stdoutFlusher {
+	return &stdoutFlusher{w: w, follow: follow, now: time.Now, last: time.Now()}
+}
+
+// lineWritten flushes the output if it is due after a line was written;
+// drained tells whether no merged line is waiting.
+func (f *stdoutFlusher) lineWritten(drained bool) error {
+	if !drained || f.w.Buffered() == 0 {
+		return nil
+	}
+	if wait := flushInterval - f.now().Sub(f.last); !f.follow && wait > 0 {
+		if f.timer == nil {
+			f.timer = time.NewTimer(wait)
+		}
+		return nil
+	}
+	return f.Flush()
+}
+
+// due returns a channel that receives once output has waited in the buffer
+// for flushInterval, and nil if none waits. The caller then flushes it.
+func (f *stdoutFlusher) due() <-chan time.Time {
+	if f.timer == nil {
+		return nil
+	}
+	return f.timer.C
+}
+
+// Flush writes all buffered output.
+func (f *stdoutFlusher) Flush() error {
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	f.last = f.now()
+	return f.w.Flush()
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// countingWriter counts the writes to it.
+type countingWriter struct{ writes int }
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return len(p), nil
+}
+
+func TestStdoutFlusher(t *testing.T) {
+	const lines = 1000
+	line := []byte("2025-06-10 14:30:00 a.log: started\n") // 35 bytes
+	tests := []struct {
+		name    string
+		follow  bool
+		drained bool          // whether no merged line is waiting after each line
+		step    time.Duration // the time between lines
+		writes  int           // including the final flush
+	}{
+		{"follow drained", true, true, 0, lines},
+		{"follow busy", true, false, 0, 35*lines/4096 + 1},
+		{"drained", false, true, 0, 35*lines/4096 + 1},
+		{"busy", false, false, 0, 35*lines/4096 + 1},
+		{"drained slowly", false, true, flushInterval / 4, lines / 4},
+		{"drained very slowly", false, true, flushInterval, lines},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cw countingWriter
+			now := time.Date(2025, time.June, 10, 14, 30, 0, 0, time.UTC)
+			f := newStdoutFlusher(bufio.NewWriter(&cw), tt.follow)
+			f.now = func() time.Time { return now }
+			f.last = now
+			for i := 0; i < lines; i++ {
+				now = now.Add(tt.step)
+				if _, err := f.w.Write(line); err != nil {
+					t.Fatal(err)
+				}
+				if err := f.lineWritten(tt.drained); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := f.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if cw.writes != tt.writes {
+				t.Errorf("%d writes for %d lines, want %d", cw.writes, lines, tt.writes)
+			}
+		})
+	}
+}
+
+func TestStdoutFlushedWhenQuiet(t *testing.T) {
+	cmd := logmergeCmd(t, "-")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer stdin.Close()
+	// the input goes quiet after two lines, without ending
+	if _, err := io.WriteString(stdin, "2025-06-10 14:30:00 a\n2025-06-10 14:30:01 b\n"); err != nil {
+		t.Fatal(err)
+	}
+	lines := make(chan string)
+	go func() {
+		r := bufio.NewReader(stdout)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- line
+		}
+	}()
+	for _, want := range []string{"2025-06-10 14:30:00 <stdin> a\n", "2025-06-10 14:30:01 <stdin> b\n"} {
+		select {
+		case got := <-lines:
+			if got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		case <-time.After(10 * flushInterval):
+			t.Fatalf("%q not output after %s", want, 10*flushInterval)
+		}
+	}
+}
+
+func TestCoalescedRunOutputWhenFollowing(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "a.log")
+	if err := os.WriteFile(file, []byte("2025-06-10 14:30:00 start\n2025-06-10 14:30:01 retry\n"+
+		"2025-06-10 14:30:02 retry\n2025-06-10 14:30:03 retry\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := logmergeCmd(t, "-f", "-coalesce", "1m", "-no-filename", file)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	lines := make(chan string)
+	go func() {
+		r := bufio.NewReader(stdout)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- line
+		}
+	}()
+	// the file stays open without a next line to end the run
+	for _, want := range []string{"2025-06-10 14:30:00 start\n", "2025-06-10 14:30:01 retry (x3)\n"} {
+		select {
+		case got := <-lines:
+			if got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		case <-time.After(10 * flushInterval):
+			t.Fatalf("%q not output after %s", want, 10*flushInterval)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressInterval is how often -progress reports.
+const progressInterval = time.Second
+
+// progress tracks the bytes read from the files for -progress. Compressed
+// files count with their compressed size. Standard input and URLs are not
+// counted, their size is unknown.
+type progress struct {
+	total int64        // size of all files
+	read  atomic.Int64 // bytes read so far
+	w     io.Writer
+	tty   bool // overwrite a single line, instead of a line per report
+	stop  chan struct{}
+	done  sync.WaitGroup
+}
+
+// readProgress is the progress of the merge with -progress, or nil.
+var readProgress *progress
+
+// newProgress returns the progress of reading files, the entries of archives
+// among them with the size of their copies, whose sizes are looked up now.
+func newProgress(files []string, archives *archiveEntries, w io.Writer, tty bool) *progress {
+	p := &progress{w: w, tty: tty, stop: make(chan struct{})}
+	for _, file := range files {
+		if file == stdinArg || isURL(file) {
+			continue
+		}
+		if fi, err := os.Stat(archives.path(file)); err == nil && fi.Mode().IsRegular() {
+			p.total += fi.Size()
+		}
+	}
+	return p
+}
+
+// count returns r, counting the bytes read from it, unless p is nil.
+func (p *progress) count(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &countingReader{r: r, p: p}
+}
+
+type countingReader struct {
+	r io.Reader
+	p *progress
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.p.read.Add(int64(n))
+	return n, err
+}
+
+// start reports the progress every progressInterval until Stop.
+func (p *progress) start() {
+	p.done.Add(1)
+	go func() {
+		defer p.done.Done()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		reported := false
+		for {
+			select {
+			case <-ticker.C:
+				p.report()
+				reported = true
+			case <-p.stop:
+				if reported && p.tty {
+					// end the line overwritten so far
+					_, _ = fmt.Fprintln(p.w)
+				}
+				return
+			}
+		}
+	}()
+}
+
+func (p *progress) report() {
+	read := p.read.Load()
+	percent := 100.0
+	if p.total > 0 {
+		percent = min(100, 100*float64(read)/float64(p.total))
+	}
+	line := fmt.Sprintf("Progress: %.0f%%, %.1f of %.1f MB", percent, float64(read)/1e6, float64(p.total)/1e6)
+	if p.tty {
+		_, _ = fmt.Fprintf(p.w, "\r\x1b[K%s", line)
+		return
+	}
+	_, _ = fmt.Fprintln(p.w, line)
+}
+
+// Stop ends the reports. It does nothing on a nil progress.
+func (p *progress) Stop() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	p.done.Wait()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"cmp"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// rotatedName splits a logrotate-style file name into the name of the current
+// file, and the rotation number (app.log.2.gz) or date (app.log-20240716).
+var rotatedName = regexp.MustCompile(`^(.*?)(?:\.(\d+)|-(\d{8}))?(?:\.gz|\.zst|\.bz2)?$`)
+
+// rotation is the position of a file in its rotation group.
+type rotation struct {
+	current string // the name of the current file of the group
+	number  int    // rotation number, 0 if none
+	date    string // rotation date, "" if none
+}
+
+func parseRotation(file string) rotation {
+	match := rotatedName.FindStringSubmatch(file)
+	r := rotation{current: match[1], date: match[3]}
+	r.number, _ = strconv.Atoi(match[2])
+	return r
+}
+
+// compareAge orders the files of a rotation group from oldest to newest:
+// dated files by date, then numbered files by decreasing number, then the
+// current file.
+func compareAge(a, b rotation) int {
+	if a.date != b.date {
+		if a.date == "" || b.date == "" {
+			return cmp.Compare(b.date, a.date) // dated ones first
+		}
+		return cmp.Compare(a.date, b.date)
+	}
+	return cmp.Compare(b.number, a.number) // the current file has number 0
+}
+
+// orderRotations orders the files of each logrotate-style rotation group,
+// such as app.log, app.log.1 and app.log.2.gz, from oldest to newest, at the
+// position of the group's first file. The order of the inputs breaks ties
+// between equal timestamps in the merge. Other files keep their order.
+func orderRotations(files []string) []string {
+	groups := map[string][]string{}
+	var order []string
+	for _, file := range files {
+		current := parseRotation(file).current
+		if _, found := groups[current]; !found {
+			order = append(order, current)
+		}
+		groups[current] = append(groups[current], file)
+	}
+	ordered := make([]string, 0, len(files))
+	for _, current := range order {
+		group := groups[current]
+		slices.SortStableFunc(group, func(a, b string) int {
+			return compareAge(parseRotation(a), parseRotation(b))
+		})
+		ordered = append(ordered, group...)
+	}
+	return ordered
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestOrderRotations(t *testing.T) {
+	tests := []struct {
+		files, want []string
+	}{
+		{
+			[]string{"app.log", "app.log.1", "app.log.2.gz", "app.log.10.gz"},
+			[]string{"app.log.10.gz", "app.log.2.gz", "app.log.1", "app.log"},
+		},
+		{
+			[]string{"app.log", "app.log-20240716", "app.log-20240714.gz", "app.log.1"},
+			[]string{"app.log-20240714.gz", "app.log-20240716", "app.log.1", "app.log"},
+		},
+		{
+			// groups stay at the position of their first file
+			[]string{"b.log", "a.log.1", "b.log.1", "c.log", "a.log"},
+			[]string{"b.log.1", "b.log", "a.log.1", "a.log", "c.log"},
+		},
+		{
+			[]string{"x/app.log", "y/app.log.1"},
+			[]string{"x/app.log", "y/app.log.1"},
+		},
+		{
+			// why -rotation is off by default
+			[]string{"run.1", "run.2", "run.10"},
+			[]string{"run.10", "run.2", "run.1"},
+		},
+		{nil, []string{}},
+	}
+	for _, tt := range tests {
+		if got := orderRotations(tt.files); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.files, got, tt.want)
+		}
+	}
+}
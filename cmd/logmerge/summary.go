@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+
+	"github.com/100days/logmerge"
+)
+
+// summarize reads allFiles, the entries of archives among them, for -summary,
+// at most maxOpen at a time unless it is 0, and returns the names of the files
+// that could be opened, their stats and the number of files that could not be
+// opened.
+func summarize(ctx context.Context, allFiles []string, archives *archiveEntries, maxOpen int, opts logmerge.Options, fileTZ fileTimezones) ([]string, *logmerge.Stats, int, error) {
+	if maxOpen == 0 {
+		maxOpen = len(allFiles)
+	}
+	var names []string
+	total := &logmerge.Stats{}
+	failed := 0
+	for start := 0; start < len(allFiles); start += maxOpen {
+		in := openInputs(ctx, allFiles[start:min(start+maxOpen, len(allFiles))], archives, false)
+		failed += in.failed
+		batchOpts := opts
+		batchOpts.Names, batchOpts.ModTimes = in.names, in.modTimes
+		batchOpts.Locations = fileTZ.locations(in.names)
+		stats, err := logmerge.Summarize(ctx, in.readers, batchOpts)
+		in.Close()
+		if err != nil {
+			return nil, nil, failed, err
+		}
+		names = append(names, in.names...)
+		total.Lines += stats.Lines
+		total.Errors = append(total.Errors, stats.Errors...)
+		total.Files = append(total.Files, stats.Files...)
+	}
+	return names, total, failed, nil
+}
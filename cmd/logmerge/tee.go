@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/100days/logmerge"
+)
+
+// teeRule is a -tee-level rule: lines of at least level are also written to
+// path.
+type teeRule struct {
+	level level
+	path  string
+}
+
+// teeRules is the repeatable -tee-level flag of "LEVEL=path" rules.
+type teeRules []teeRule
+
+func (t *teeRules) String() string {
+	rules := make([]string, len(*t))
+	for i, rule := range *t {
+		rules[i] = rule.level.String() + "=" + rule.path
+	}
+	return strings.Join(rules, ", ")
+}
+
+func (t *teeRules) Set(value string) error {
+	name, path, found := strings.Cut(value, "=")
+	if !found || path == "" {
+		return fmt.Errorf("expected LEVEL=path, e.g. ERROR=errors.log")
+	}
+	l, err := parseLevel(name)
+	if err != nil {
+		return err
+	}
+	*t = append(*t, teeRule{level: l, path: path})
+	return nil
+}
+
+// tee is an opened -tee-level output.
+type tee struct {
+	level level
+	file  *outputFile
+	out   lineWriter
+}
+
+// tees write the output lines of a level to further files, like the main
+// output in format and opts, but never colored.
+type tees []tee
+
+func openTees(rules teeRules, format string, opts outputOptions) (tees, error) {
+	opts.color, opts.levelColors = false, nil
+	var t tees
+	for _, rule := range rules {
+		file, err := createOutputFile(rule.path)
+		if err != nil {
+			t.Abort()
+			return nil, err
+		}
+		out, err := newLineWriter(format, file, opts)
+		if err != nil {
+			file.Abort()
+			t.Abort()
+			return nil, err
+		}
+		t = append(t, tee{level: rule.level, file: file, out: out})
+	}
+	return t, nil
+}
+
+// WriteLine writes line to the tees whose level it has at least.
+func (t tees) WriteLine(line logmerge.Line) error {
+	if len(t) == 0 {
+		return nil
+	}
+	l := lineLevel(line)
+	for _, target := range t {
+		if l != levelUnknown && l >= target.level {
+			if err := target.out.WriteLine(line); err != nil {
+				return fmt.Errorf("%s: %w", target.file.path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Close flushes and closes all tees, see outputFile.Close.
+func (t tees) Close() error {
+	var errs []error
+	for _, target := range t {
+		if err := target.file.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target.file.path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Abort discards all tees, see outputFile.Abort.
+func (t tees) Abort() {
+	for _, target := range t {
+		target.file.Abort()
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultTimeout is the default of -timeout.
+const defaultTimeout = 30 * time.Second
+
+// httpClient fetches URL arguments, see newHTTPClient.
+var httpClient = newHTTPClient(defaultTimeout)
+
+// newHTTPClient returns a client that waits at most timeout for a server to
+// accept the connection and to start its response, unless timeout is 0. The
+// body itself may take as long as it takes.
+func newHTTPClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	transport.TLSHandshakeTimeout = timeout
+	return &http.Client{Transport: transport}
+}
+
+// isURL reports whether a file argument is an http or https URL.
+func isURL(file string) bool {
+	return strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://")
+}
+
+// baseName returns the last element of the path of a file, or of a URL
+// without its query and fragment, or its host if it has no path.
+func baseName(file string) string {
+	if !isURL(file) {
+		return filepath.Base(file)
+	}
+	u, err := url.Parse(file)
+	if err != nil {
+		return filepath.Base(file)
+	}
+	if base := path.Base(u.Path); base != "." && base != "/" {
+		return base
+	}
+	return u.Host
+}
+
+// openURL fetches rawURL and returns its body and its Last-Modified time, zero
+// if unknown. A response status other than 200 is an error. Compressed
+// bodies are recognized by decompressReader like files.
+func openURL(ctx context.Context, rawURL string) (io.ReadCloser, time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, time.Time{}, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return resp.Body, modTime, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestBaseName(t *testing.T) {
+	tests := []struct {
+		file, want string
+	}{
+		{"app.log", "app.log"},
+		{"/var/log/app.log", "app.log"},
+		{"logs.tar/app/app.log", "app.log"},
+		{"https://example.com/logs/app.log", "app.log"},
+		{"https://example.com/logs/app.log?token=secret&x=1", "app.log"},
+		{"https://example.com/logs/app.log.gz#part", "app.log.gz"},
+		{"https://example.com/logs/", "logs"},
+		{"https://example.com/download?file=app.log", "download"},
+		{"https://example.com/?token=secret", "example.com"},
+		{"http://example.com:8080", "example.com:8080"},
+	}
+	for _, tt := range tests {
+		if got := baseName(tt.file); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestFileColumnURL(t *testing.T) {
+	const u = "https://example.com/logs/app.log?token=secret"
+	tests := []struct {
+		nameLen int
+		want    string
+	}{
+		{0, u},
+		{-1, "app.log"},
+		{20, "app.log"},
+		{3, "log"},
+	}
+	for _, tt := range tests {
+		if got := fileColumn(u, tt.nameLen); got != tt.want {
+			t.Errorf("-namelen %d: got %q, want %q", tt.nameLen, got, tt.want)
+		}
+	}
+}
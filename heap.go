@@ -0,0 +1,36 @@
+package logmerge
+
+import "time"
+
+// fileHead is the pending line of an input file in the merge.
+type fileHead struct {
+	timestamp time.Time
+	index     int
+}
+
+// headHeap is a min-heap of fileHeads for container/heap. Equal timestamps
+// are ordered by file index, so lines with the same timestamp are merged in
+// the order of the inputs, independent of the heap layout. As each input has
+// a single head, its own lines keep their read order.
+type headHeap []fileHead
+
+func (h headHeap) Len() int { return len(h) }
+
+func (h headHeap) Less(i, j int) bool {
+	if h[i].timestamp.Equal(h[j].timestamp) {
+		return h[i].index < h[j].index
+	}
+	return h[i].timestamp.Before(h[j].timestamp)
+}
+
+func (h headHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *headHeap) Push(x any) { *h = append(*h, x.(fileHead)) }
+
+func (h *headHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
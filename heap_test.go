@@ -0,0 +1,60 @@
+package logmerge
+
+import (
+	"container/heap"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHeadHeapOrder(t *testing.T) {
+	t0 := time.Date(2025, time.June, 10, 14, 30, 0, 0, time.UTC)
+	heads := headHeap{
+		{timestamp: t0.Add(time.Second), index: 0},
+		{timestamp: t0, index: 3},
+		{timestamp: t0, index: 1},
+		{timestamp: t0.Add(-time.Second), index: 2},
+	}
+	heap.Init(&heads)
+	var got []int
+	for heads.Len() > 0 {
+		got = append(got, heap.Pop(&heads).(fileHead).index)
+	}
+	if want := []int{2, 1, 3, 0}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("heap order %v, want %v", got, want)
+	}
+}
+
+// BenchmarkEarliest compares finding the earliest of n heads with the heap,
+// as mergeLogs does, with a linear scan, as it did before.
+func BenchmarkEarliest(b *testing.B) {
+	t0 := time.Date(2025, time.June, 10, 0, 0, 0, 0, time.UTC)
+	for _, n := range []int{2, 20, 200} {
+		b.Run(fmt.Sprintf("heap/%d", n), func(b *testing.B) {
+			heads := make(headHeap, n)
+			for i := range heads {
+				heads[i] = fileHead{timestamp: t0.Add(time.Duration(i) * time.Second), index: i}
+			}
+			heap.Init(&heads)
+			for i := 0; i < b.N; i++ {
+				heads[0].timestamp = heads[0].timestamp.Add(time.Duration(n) * time.Second)
+				heap.Fix(&heads, 0)
+			}
+		})
+		b.Run(fmt.Sprintf("scan/%d", n), func(b *testing.B) {
+			timestamps := make([]time.Time, n)
+			for i := range timestamps {
+				timestamps[i] = t0.Add(time.Duration(i) * time.Second)
+			}
+			for i := 0; i < b.N; i++ {
+				earliest := 0
+				for j := 1; j < n; j++ {
+					if timestamps[j].Before(timestamps[earliest]) {
+						earliest = j
+					}
+				}
+				timestamps[earliest] = timestamps[earliest].Add(time.Duration(n) * time.Second)
+			}
+		})
+	}
+}
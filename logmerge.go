@@ -0,0 +1,499 @@
+// Package logmerge merges log files line by line by increasing timestamps.
+//
+// The timestamp format of each line is detected automatically, see Pattern.
+// The inputs are assumed to be sorted by time already.
+package logmerge
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// DefaultMaxLineLength is the longest line Merge reads if
+// Options.MaxLineLength is not set.
+const DefaultMaxLineLength = 4 * 1024 * 1024
+
+// Line is a single log line, as parsed from an input and as delivered by
+// Merge.
+type Line struct {
+	Timestamp    time.Time
+	RawTimestamp string // the timestamp as matched in the line
+	RawOffset    int    // byte offset of RawTimestamp in the original line
+	Filename     string // the name of the input, see Options.Names
+	RestOfLine   string // the line without its timestamp
+	LineNo       int    // 1-based number of the line in its input
+	Orphan       bool   // the line has no timestamp, Timestamp is that of the previous line of its input
+}
+
+// Message returns RestOfLine without the blank that separated the timestamp
+// from the text if the timestamp started the line.
+func (l Line) Message() string {
+	if l.RawOffset == 0 && l.RestOfLine != "" && (l.RestOfLine[0] == ' ' || l.RestOfLine[0] == '\t') {
+		return l.RestOfLine[1:]
+	}
+	return l.RestOfLine
+}
+
+// OriginalLine returns the line as read from the input, timestamp included.
+func (l Line) OriginalLine() string {
+	return l.RestOfLine[:l.RawOffset] + l.RawTimestamp + l.RestOfLine[l.RawOffset:]
+}
+
+// Stats are collected during a merge. They may be read once the channel
+// returned by Merge is closed.
+type Stats struct {
+	Lines       int         // lines read from all inputs
+	CacheHits   int         // lines parsed with one of the timestamp patterns remembered for their input
+	CacheMisses int         // lines with timestamp for which the remembered patterns failed
+	Errors      []error     // per input, the error that ended reading it, nil if read to its end
+	Files       []FileStats // per input
+}
+
+// FileStats are the Stats of a single input.
+type FileStats struct {
+	Lines       int       // lines read
+	CacheHits   int       // see Stats.CacheHits
+	CacheMisses int       // see Stats.CacheMisses
+	NoTimestamp int       // lines without timestamp
+	First, Last time.Time // first and last timestamp read, zero if none
+}
+
+// Options configures Merge. The zero value merges all lines of all inputs.
+type Options struct {
+	StartTime time.Time // lines before StartTime are skipped, unless zero
+	EndTime   time.Time // each input ends at its first line after EndTime, unless zero
+	Separator string    // field separator used by Write, default " "
+	Verbose   bool      // log the end of each input and out of order lines to Logger
+
+	Multiline     bool // append lines without timestamp to the previous line, joined by \n
+	MaxLineLength int  // longest line in bytes an input may contain, default DefaultMaxLineLength
+	Preamble      bool // prepend the lines before the first timestamp of an input to its first line, instead of skipping them
+
+	RequireTimestamps int  // give up on an input without timestamp in its first RequireTimestamps lines, unless 0
+	SkipBinary        bool // give up on an input with a NUL byte before or in its first line with timestamp
+
+	Include []*regexp.Regexp // only keep lines matching any of these, if given
+	Exclude []*regexp.Regexp // drop lines matching any of these, takes precedence over Include
+
+	Location  *time.Location   // timezone of timestamps without offset, default UTC
+	Locations []*time.Location // optional timezones per input, overriding Location where not nil
+	Patterns  []Pattern        // additional timestamp patterns, tried before the built-in ones
+	Parsers   []Parser         // tried in order before Patterns and the built-in patterns
+	DateOrder DateOrder        // order of numeric dates like 06/10/2025, which are only read with 24-hour times if set
+
+	// Offsets of zone abbreviations like MST, e.g. time.FixedZone("MST", -7*3600),
+	// before those of Location and the built-in US and European ones.
+	ZoneAbbreviations map[string]*time.Location
+
+	// If TimestampTo > 0, the patterns only search line[TimestampFrom:TimestampTo]
+	// of the lines that long, e.g. the timestamp column of fixed-width logs.
+	// Shorter lines are searched as a whole. Parsers get the whole line.
+	TimestampFrom, TimestampTo int
+
+	Names    []string    // optional names of the inputs, reported as Line.Filename
+	ModTimes []time.Time // optional modification times of the inputs, to infer the year of year-less timestamps
+
+	Buffer int          // capacity of the channel returned by Merge, 0 for unbuffered
+	Logger *slog.Logger // receives errors reading the inputs, nil discards them
+	Stats  *Stats       // filled during the merge if not nil
+}
+
+// merger holds the state of a single Merge.
+type merger struct {
+	opts      Options
+	patterns  []Pattern
+	locations []*time.Location // per input, Options.Locations or Location
+}
+
+// Merge reads each input in a separate goroutine and returns their lines
+// merged by increasing timestamp on the returned channel, which is closed
+// when all inputs are exhausted or have passed EndTime. Lines without timestamp
+// keep the timestamp of the previous line of their input. Timestamps are
+// compared at their full parsed precision; equal timestamps are delivered in
+// the order of the inputs.
+//
+// Cancelling ctx stops the merge between two lines and closes the channel.
+// The inputs are not closed by Merge, that is up to the caller. When the merge
+// ends early, by ctx or EndTime, a read of an input in progress may complete
+// after the channel is closed, no further reads follow.
+func Merge(ctx context.Context, inputs []io.Reader, opts Options) (<-chan Line, error) {
+	m, err := newMerger(inputs, opts)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan Line, opts.Buffer)
+	go m.mergeLogs(ctx, inputs, ch)
+	return ch, nil
+}
+
+// Source is a named input of MergeSources, e.g. a file, an in-memory buffer
+// or a network stream.
+type Source struct {
+	Name string // reported as Line.Filename
+	R    io.Reader
+}
+
+// MergeSources merges sources like Merge, with their names instead of
+// Options.Names. Each source keeps its own state of the parsing, such as the
+// patterns that recently matched, whatever kind of reader it is.
+func MergeSources(ctx context.Context, sources []Source, opts Options) (<-chan Line, error) {
+	inputs := make([]io.Reader, len(sources))
+	opts.Names = make([]string, len(sources))
+	for i, source := range sources {
+		inputs[i], opts.Names[i] = source.R, source.Name
+	}
+	return Merge(ctx, inputs, opts)
+}
+
+// newMerger checks opts against inputs and returns the merger of a Merge or
+// Summarize.
+func newMerger(inputs []io.Reader, opts Options) (*merger, error) {
+	if opts.Names != nil && len(opts.Names) != len(inputs) {
+		return nil, fmt.Errorf("got %d names for %d inputs", len(opts.Names), len(inputs))
+	}
+	if opts.ModTimes != nil && len(opts.ModTimes) != len(inputs) {
+		return nil, fmt.Errorf("got %d modification times for %d inputs", len(opts.ModTimes), len(inputs))
+	}
+	if opts.Locations != nil && len(opts.Locations) != len(inputs) {
+		return nil, fmt.Errorf("got %d locations for %d inputs", len(opts.Locations), len(inputs))
+	}
+	if opts.MaxLineLength < 0 {
+		return nil, errors.New("negative maximum line length")
+	}
+	if opts.Buffer < 0 {
+		return nil, errors.New("negative buffer")
+	}
+	if opts.TimestampFrom < 0 || (opts.TimestampTo > 0 && opts.TimestampTo <= opts.TimestampFrom) {
+		return nil, fmt.Errorf("invalid timestamp columns %d:%d", opts.TimestampFrom, opts.TimestampTo)
+	}
+	if opts.MaxLineLength == 0 {
+		opts.MaxLineLength = DefaultMaxLineLength
+	}
+	numericDates, found := numericDatePatterns[opts.DateOrder]
+	if opts.DateOrder != "" && !found {
+		return nil, fmt.Errorf("unknown date order %q", opts.DateOrder)
+	}
+
+	m := &merger{
+		opts:     opts,
+		patterns: append(append([]Pattern(nil), opts.Patterns...), timestampPatterns...),
+	}
+	if layouts := dateOrderLayouts[opts.DateOrder]; layouts != nil {
+		for i := len(opts.Patterns); i < len(m.patterns); i++ {
+			if layout, found := layouts[m.patterns[i].Layout]; found {
+				m.patterns[i].Layout = layout
+			}
+		}
+	}
+	// after the others, which fastMatch refers to by index
+	if found {
+		m.patterns = append(m.patterns, numericDates)
+	}
+	location := opts.Location
+	if location == nil {
+		location = time.UTC
+	}
+	m.locations = make([]*time.Location, len(inputs))
+	for i := range m.locations {
+		m.locations[i] = location
+		if opts.Locations != nil && opts.Locations[i] != nil {
+			m.locations[i] = opts.Locations[i]
+		}
+	}
+	return m, nil
+}
+
+// name returns the name of input i.
+func (m *merger) name(i int) string {
+	if m.opts.Names != nil {
+		return m.opts.Names[i]
+	}
+	return fmt.Sprintf("input %d", i)
+}
+
+// logError logs msg about input i to Logger, with the name of the input as
+// attribute "file" before args.
+func (m *merger) logError(i int, msg string, args ...any) {
+	if m.opts.Logger != nil {
+		m.opts.Logger.Error(msg, append([]any{"file", m.name(i)}, args...)...)
+	}
+}
+
+// logWarn is logError at warning level.
+func (m *merger) logWarn(i int, msg string, args ...any) {
+	if m.opts.Logger != nil {
+		m.opts.Logger.Warn(msg, append([]any{"file", m.name(i)}, args...)...)
+	}
+}
+
+// keep reports whether a line passes the Include and Exclude filters.
+func (m *merger) keep(restOfLine string) bool {
+	for _, re := range m.opts.Exclude {
+		if re.MatchString(restOfLine) {
+			return false
+		}
+	}
+	if len(m.opts.Include) == 0 {
+		return true
+	}
+	for _, re := range m.opts.Include {
+		if re.MatchString(restOfLine) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeLogs merges the lines of all inputs by increasing timestamp and sends
+// every line within [StartTime, EndTime] that passes the filters on ch. ch is
+// closed when done or when ctx is cancelled.
+func (m *merger) mergeLogs(ctx context.Context, inputs []io.Reader, ch chan<- Line) {
+	startTime, endTime := m.opts.StartTime, m.opts.EndTime
+
+	defer close(ch)
+	readers := make([]*reader, len(inputs))
+	results := make([]chan readResult, len(inputs))
+	// stop a reader when the merge ends before it, or its input passed EndTime
+	stopReaders := make([]context.CancelFunc, len(inputs))
+	for i, r := range inputs {
+		var readCtx context.Context
+		readCtx, stopReaders[i] = context.WithCancel(ctx)
+		defer stopReaders[i]()
+		readers[i] = m.newReader(i, r)
+		results[i] = make(chan readResult, readAhead)
+		go readers[i].run(readCtx, results[i])
+	}
+
+	fileErrors := make([]error, len(inputs))
+	if m.opts.Stats != nil {
+		defer func() {
+			*m.opts.Stats = collectStats(readers, fileErrors)
+		}()
+	}
+
+	// readNext receives the next line of input i from its reader
+	readNext := func(i int) (Line, error) {
+		select {
+		case result, ok := <-results[i]:
+			if !ok {
+				// the reader only stops early when ctx is cancelled
+				return Line{}, ctx.Err()
+			}
+			return result.line, result.err
+		case <-ctx.Done():
+			return Line{}, ctx.Err()
+		}
+	}
+
+	current := make([]Line, len(inputs))
+	for i := range inputs {
+		current[i], fileErrors[i] = readNext(i)
+		if isReadError(fileErrors[i]) && ctx.Err() == nil {
+			m.logError(i, "reading input failed", "error", fileErrors[i])
+		}
+	}
+
+	heads := make(headHeap, 0, len(inputs))
+	for i := range inputs {
+		if fileErrors[i] == nil {
+			heads = append(heads, fileHead{timestamp: current[i].Timestamp, index: i})
+		}
+	}
+	heap.Init(&heads)
+
+	for heads.Len() > 0 && ctx.Err() == nil {
+		earliestIndex := heads[0].index
+		earliestTime := heads[0].timestamp
+
+		if (startTime.IsZero() || !earliestTime.Before(startTime)) && (endTime.IsZero() || !earliestTime.After(endTime)) &&
+			m.keep(current[earliestIndex].RestOfLine) {
+			select {
+			case ch <- current[earliestIndex]:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if !endTime.IsZero() && earliestTime.After(endTime) {
+			// only this input is done, another one may still be behind it
+			if m.opts.Verbose {
+				m.logWarn(earliestIndex, "passed the end time", "timestamp", earliestTime)
+			}
+			stopReaders[earliestIndex]()
+			heap.Pop(&heads)
+			continue
+		}
+
+		// Read the next timestamp from the input that had the earliest timestamp
+		next, err := readNext(earliestIndex)
+		if err == nil {
+			if m.opts.Verbose && next.Timestamp.Before(earliestTime) {
+				m.logWarn(earliestIndex, "input is not sorted, the output is out of order",
+					"timestamp", next.Timestamp, "previous", earliestTime)
+			}
+			current[earliestIndex] = next
+			heads[0].timestamp = next.Timestamp
+			heap.Fix(&heads, 0)
+		} else if errors.Is(err, NoTimestampError) {
+			// no timestamp in this line, keep the old timestamp
+			next.Timestamp = earliestTime
+			next.Orphan = true
+			current[earliestIndex] = next
+		} else {
+			if ctx.Err() != nil {
+				// the input stopped reading because of the cancellation
+			} else if isReadError(err) {
+				m.logError(earliestIndex, "reading input failed", "error", err)
+			} else if m.opts.Verbose {
+				m.logWarn(earliestIndex, "input ended", "reason", err)
+			}
+			fileErrors[earliestIndex] = err
+			heap.Pop(&heads)
+		}
+	}
+}
+
+// collectStats returns the Stats of readers, which ended with fileErrors.
+func collectStats(readers []*reader, fileErrors []error) Stats {
+	stats := Stats{Errors: make([]error, len(readers)), Files: make([]FileStats, len(readers))}
+	for i, r := range readers {
+		stats.Files[i] = r.fileStats()
+		stats.Lines += stats.Files[i].Lines
+		stats.CacheHits += stats.Files[i].CacheHits
+		stats.CacheMisses += stats.Files[i].CacheMisses
+		if isReadError(fileErrors[i]) {
+			stats.Errors[i] = fileErrors[i]
+		}
+	}
+	return stats
+}
+
+// Summarize reads all inputs in parallel like Merge, but only collects their
+// Stats instead of merging their lines, e.g. to see the time range each input
+// covers. StartTime, EndTime, Include, Exclude and Options.Stats do not apply.
+// It returns ctx.Err() if ctx is cancelled before all inputs are read.
+func Summarize(ctx context.Context, inputs []io.Reader, opts Options) (Stats, error) {
+	m, err := newMerger(inputs, opts)
+	if err != nil {
+		return Stats{}, err
+	}
+	readers := make([]*reader, len(inputs))
+	fileErrors := make([]error, len(inputs))
+	var wg sync.WaitGroup
+	for i, r := range inputs {
+		readers[i] = m.newReader(i, r)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fileErrors[i] = readers[i].skipAll(ctx)
+			if isReadError(fileErrors[i]) && ctx.Err() == nil {
+				m.logError(i, "reading input failed", "error", fileErrors[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return collectStats(readers, fileErrors), ctx.Err()
+}
+
+// Detect reads input up to its first line with timestamp, like Merge, and
+// returns that line and the pattern that matched it, the zero Pattern if one
+// of Options.Parsers did. Without any timestamp it reads the whole input,
+// unless Options.RequireTimestamps limits it.
+func Detect(input io.Reader, opts Options) (Line, Pattern, error) {
+	opts.Multiline = false // the pattern of the line after the first would count
+	m, err := newMerger([]io.Reader{input}, opts)
+	if err != nil {
+		return Line{}, Pattern{}, err
+	}
+	r := m.newReader(0, input)
+	line, err := r.readFirst()
+	if err != nil || len(r.recent) == 0 {
+		return line, Pattern{}, err
+	}
+	return line, m.patterns[r.recent[0]], nil
+}
+
+// MergeLines merges streams of lines that are each ordered by timestamp, such
+// as the results of several Merge calls, into a single ordered stream. Equal
+// timestamps are delivered in the order of the streams. The returned channel
+// is closed when all streams are closed or ctx is cancelled; the streams
+// should then stop sending on ctx as well.
+func MergeLines(ctx context.Context, streams []<-chan Line) <-chan Line {
+	ch := make(chan Line)
+	go func() {
+		defer close(ch)
+
+		receive := func(i int) (Line, bool) {
+			select {
+			case line, ok := <-streams[i]:
+				return line, ok
+			case <-ctx.Done():
+				return Line{}, false
+			}
+		}
+
+		current := make([]Line, len(streams))
+		heads := make(headHeap, 0, len(streams))
+		for i := range streams {
+			line, ok := receive(i)
+			if ok {
+				current[i] = line
+				heads = append(heads, fileHead{timestamp: line.Timestamp, index: i})
+			}
+		}
+		heap.Init(&heads)
+
+		for heads.Len() > 0 {
+			i := heads[0].index
+			select {
+			case ch <- current[i]:
+			case <-ctx.Done():
+				return
+			}
+			line, ok := receive(i)
+			if !ok {
+				heap.Pop(&heads)
+				continue
+			}
+			current[i] = line
+			heads[0].timestamp = line.Timestamp
+			heap.Fix(&heads, 0)
+		}
+	}()
+	return ch
+}
+
+// FilenamePrefix shortens filename to its last 20 characters for the text
+// output.
+func FilenamePrefix(filename string) string {
+	// Get the last 20 characters of the filename
+	if len(filename) > 20 {
+		return filename[len(filename)-20:]
+	}
+	return filename
+}
+
+// Write writes lines to w in logmerge's text format, "timestamp sep filename
+// sep line", with the base name of the file shortened by FilenamePrefix and
+// opts.Separator as sep. It returns after lines is closed or on the first
+// write error.
+func Write(w io.Writer, lines <-chan Line, opts Options) error {
+	separator := opts.Separator
+	if separator == "" {
+		separator = " "
+	}
+	for line := range lines {
+		filenamePrefix := FilenamePrefix(filepath.Base(line.Filename))
+		if _, err := fmt.Fprintf(w, "%s%s%s%s%s\n", line.Timestamp.Format("2006-01-02 15:04:05"), separator, filenamePrefix, separator, line.Message()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
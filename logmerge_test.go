@@ -0,0 +1,344 @@
+package logmerge
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// merge merges inputs named a, b, c, ... with opts and returns the lines
+// as "name: original line".
+func merge(t *testing.T, opts Options, inputs ...string) []string {
+	t.Helper()
+	readers := make([]io.Reader, len(inputs))
+	opts.Names = make([]string, len(inputs))
+	for i, input := range inputs {
+		readers[i] = strings.NewReader(input)
+		opts.Names[i] = string(rune('a' + i))
+	}
+	ch, err := Merge(context.Background(), readers, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for line := range ch {
+		lines = append(lines, line.Filename+": "+line.OriginalLine())
+	}
+	return lines
+}
+
+// checkLines reports the differences of got and want.
+func checkLines(t *testing.T, got, want []string) {
+	t.Helper()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n\t%s\nwant\n\t%s", strings.Join(got, "\n\t"), strings.Join(want, "\n\t"))
+	}
+}
+
+func TestMaxLineLength(t *testing.T) {
+	long := "2025-06-10 14:30:01 " + strings.Repeat("x", 200)
+	tests := []struct {
+		name      string
+		maxLength int
+		want      []string
+		tooLong   bool
+	}{
+		{"within", 256, []string{"a: 2025-06-10 14:30:00 first", "b: " + long, "a: 2025-06-10 14:30:02 last"}, false},
+		{"default", 0, []string{"a: 2025-06-10 14:30:00 first", "b: " + long, "a: 2025-06-10 14:30:02 last"}, false},
+		{"over", 100, []string{"a: 2025-06-10 14:30:00 first", "a: 2025-06-10 14:30:02 last"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stats Stats
+			got := merge(t, Options{MaxLineLength: tt.maxLength, Stats: &stats},
+				"2025-06-10 14:30:00 first\n2025-06-10 14:30:02 last\n",
+				long+"\n2025-06-10 14:30:03 after\n")
+			if !tt.tooLong {
+				tt.want = append(tt.want, "b: 2025-06-10 14:30:03 after")
+			}
+			checkLines(t, got, tt.want)
+			if err := stats.Errors[1]; errors.Is(err, bufio.ErrTooLong) != tt.tooLong {
+				t.Errorf("error %v, want too long %v", err, tt.tooLong)
+			}
+			if stats.Errors[0] != nil {
+				t.Errorf("error %v in the other input", stats.Errors[0])
+			}
+		})
+	}
+}
+
+func TestMaxLineLengthHuge(t *testing.T) {
+	huge := "2025-06-10 14:30:01 " + strings.Repeat("x", 3*1024*1024)
+	got := merge(t, Options{}, "2025-06-10 14:30:00 first\n2025-06-10 14:30:02 last\n", huge+"\n")
+	if len(got) != 3 || got[1] != "b: "+huge {
+		t.Errorf("the huge line was not merged whole")
+	}
+}
+
+func TestLogMessages(t *testing.T) {
+	var buf strings.Builder
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	merge(t, Options{Logger: logger, Verbose: true},
+		"preamble\n2025-06-10 14:30:02 second\n2025-06-10 14:30:01 first\n",
+		"2025-06-10 14:30:00 zero\n")
+	want := []string{
+		`level=WARN msg="skipped lines before the first timestamp" file=a lines=1`,
+		`level=WARN msg="input ended" file=b reason="end of file"`,
+		`level=WARN msg="input is not sorted, the output is out of order" file=a timestamp=2025-06-10T14:30:01.000Z previous=2025-06-10T14:30:02.000Z`,
+		`level=WARN msg="input ended" file=a reason="end of file"`,
+	}
+	checkLines(t, strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"), want)
+}
+
+func TestMergeOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs []string
+		want   []string
+	}{
+		{
+			name: "interleaved",
+			inputs: []string{
+				"2025-06-10 14:30:00 a0\n2025-06-10 14:30:02 a2\n2025-06-10 14:30:04 a4\n",
+				"2025-06-10 14:30:01 b1\n2025-06-10 14:30:03 b3\n",
+			},
+			want: []string{
+				"a: 2025-06-10 14:30:00 a0",
+				"b: 2025-06-10 14:30:01 b1",
+				"a: 2025-06-10 14:30:02 a2",
+				"b: 2025-06-10 14:30:03 b3",
+				"a: 2025-06-10 14:30:04 a4",
+			},
+		},
+		{
+			name: "ties by input order",
+			inputs: []string{
+				"2025-06-10 14:30:01 a1\n2025-06-10 14:30:01 a2\n",
+				"2025-06-10 14:30:00 b0\n2025-06-10 14:30:01 b1\n",
+				"2025-06-10 14:30:01 c1\n",
+			},
+			want: []string{
+				"b: 2025-06-10 14:30:00 b0",
+				"a: 2025-06-10 14:30:01 a1",
+				"a: 2025-06-10 14:30:01 a2",
+				"b: 2025-06-10 14:30:01 b1",
+				"c: 2025-06-10 14:30:01 c1",
+			},
+		},
+		{
+			name: "lines without timestamp follow their line",
+			inputs: []string{
+				"2025-06-10 14:30:00 a0\npanic: oops\n\tat main.go:1\n2025-06-10 14:30:02 a2\n",
+				"2025-06-10 14:30:01 b1\n",
+			},
+			want: []string{
+				"a: 2025-06-10 14:30:00 a0",
+				"a: panic: oops",
+				"a: \tat main.go:1",
+				"b: 2025-06-10 14:30:01 b1",
+				"a: 2025-06-10 14:30:02 a2",
+			},
+		},
+		{
+			name: "different formats",
+			inputs: []string{
+				"Jun 10 14:30:01 host app: a1\n",
+				"2025-06-10T14:30:00Z b0\n2025-06-10T14:30:02Z b2\n",
+			},
+			want: []string{
+				"b: 2025-06-10T14:30:00Z b0",
+				"a: Jun 10 14:30:01 host app: a1",
+				"b: 2025-06-10T14:30:02Z b2",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the year of syslog timestamps
+			modTimes := make([]time.Time, len(tt.inputs))
+			for i := range modTimes {
+				modTimes[i] = time.Date(2025, time.June, 11, 0, 0, 0, 0, time.UTC)
+			}
+			checkLines(t, merge(t, Options{ModTimes: modTimes}, tt.inputs...), tt.want)
+		})
+	}
+}
+
+func TestOrphanTimestamp(t *testing.T) {
+	ch, err := Merge(context.Background(), []io.Reader{strings.NewReader("2025-06-10 14:30:00 a\ncontinued\n")}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, orphan := <-ch, <-ch
+	if first.Orphan || !orphan.Orphan || !orphan.Timestamp.Equal(first.Timestamp) || orphan.RestOfLine != "continued" {
+		t.Errorf("got %+v after %+v, want an orphan with the timestamp of the line before", orphan, first)
+	}
+}
+
+func TestLineNo(t *testing.T) {
+	input := "preamble\n2025-06-10 14:30:00 a\npanic: oops\n\tat main.go:1\n2025-06-10 14:30:01 b\n2025-06-10 14:30:02 c\n"
+	tests := []struct {
+		multiline bool
+		want      []int
+	}{
+		// folded lines are counted, like those skipped before the first timestamp
+		{true, []int{2, 5, 6}},
+		{false, []int{2, 3, 4, 5, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint("multiline=", tt.multiline), func(t *testing.T) {
+			ch, err := Merge(context.Background(), []io.Reader{strings.NewReader(input)}, Options{Multiline: tt.multiline})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for line := range ch {
+				got = append(got, line.LineNo)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got line numbers %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubsecondOrder(t *testing.T) {
+	// 1749513601 is 2025-06-10 00:00:01 UTC
+	got := merge(t, Options{},
+		"2025-06-10 00:00:01.100 ms\n2025-06-10 00:00:01,200 ms\n",
+		"1749513601.050000 us\n1749513601.150001 us\n",
+		"1749513601.100000001 ns\n1749513601.199999999 ns\n")
+	checkLines(t, got, []string{
+		"b: 1749513601.050000 us",
+		"a: 2025-06-10 00:00:01.100 ms",
+		"c: 1749513601.100000001 ns",
+		"b: 1749513601.150001 us",
+		"c: 1749513601.199999999 ns",
+		"a: 2025-06-10 00:00:01,200 ms",
+	})
+}
+
+// failingReader returns the lines of r and then err.
+type failingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, f.err
+	}
+	return n, err
+}
+
+func TestReadError(t *testing.T) {
+	errDisk := errors.New("disk on fire")
+	var buf strings.Builder
+	var stats Stats
+	ch, err := MergeSources(context.Background(), []Source{
+		{"ok.log", strings.NewReader("2025-06-10 14:30:00 ok0\n2025-06-10 14:30:02 ok2\n2025-06-10 14:30:04 ok4\n")},
+		{"bad.log", &failingReader{strings.NewReader("2025-06-10 14:30:01 bad1\n2025-06-10 14:30:03 bad3\n"), errDisk}},
+		{"ok2.log", strings.NewReader("2025-06-10 14:30:05 ok5\n")},
+	}, Options{Logger: slog.New(slog.NewTextHandler(&buf, nil)), Stats: &stats})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for line := range ch {
+		got = append(got, line.Message())
+	}
+	checkLines(t, got, []string{"ok0", "bad1", "ok2", "bad3", "ok4", "ok5"})
+	if !errors.Is(stats.Errors[1], errDisk) || stats.Errors[0] != nil || stats.Errors[2] != nil {
+		t.Errorf("errors %v, want %v of bad.log only", stats.Errors, errDisk)
+	}
+	if want := `level=ERROR msg="reading input failed" file=bad.log error="after line 2: disk on fire"`; !strings.Contains(buf.String(), want) {
+		t.Errorf("logged %q, want %q", buf.String(), want)
+	}
+}
+
+func TestEndTimeSkewedClocks(t *testing.T) {
+	var buf strings.Builder
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	end := time.Date(2025, time.June, 10, 14, 30, 3, 0, time.UTC)
+	// the clock of a runs ahead of that of b, which is still before the end
+	// time when a has passed it
+	got := merge(t, Options{EndTime: end, Verbose: true, Logger: logger},
+		"2025-06-10 14:30:02 a2\n2025-06-10 14:30:06 a6\n2025-06-10 14:30:07 a7\n",
+		"2025-06-10 14:29:58 b58\n2025-06-10 14:30:01 b1\n2025-06-10 14:30:03 b3\n2025-06-10 14:30:04 b4\n")
+	checkLines(t, got, []string{
+		"b: 2025-06-10 14:29:58 b58",
+		"b: 2025-06-10 14:30:01 b1",
+		"a: 2025-06-10 14:30:02 a2",
+		"b: 2025-06-10 14:30:03 b3",
+	})
+	var passed []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(line, "passed the end time") {
+			passed = append(passed, line)
+		}
+	}
+	checkLines(t, passed, []string{
+		`level=WARN msg="passed the end time" file=b timestamp=2025-06-10T14:30:04.000Z`,
+		`level=WARN msg="passed the end time" file=a timestamp=2025-06-10T14:30:06.000Z`,
+	})
+}
+
+// logInputs returns n inputs of the given number of ISO timestamped lines,
+// which interleave in the merge.
+func logInputs(n, lines int) []string {
+	start := time.Date(2025, time.June, 10, 0, 0, 0, 0, time.UTC)
+	inputs := make([]string, n)
+	for i := range inputs {
+		var b strings.Builder
+		for j := 0; j < lines; j++ {
+			timestamp := start.Add(time.Duration(j*n+i) * time.Millisecond)
+			fmt.Fprintf(&b, "%s INFO request %d of worker %d done\n", timestamp.Format("2006-01-02 15:04:05.000"), j, i)
+		}
+		inputs[i] = b.String()
+	}
+	return inputs
+}
+
+// BenchmarkMerge merges four inputs of 10000 lines with different capacities
+// of the channel returned by Merge.
+func BenchmarkMerge(b *testing.B) {
+	inputs := logInputs(4, 10000)
+	for _, buffer := range []int{0, 64, 1024, 4096} {
+		b.Run(fmt.Sprintf("buffer=%d", buffer), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				readers := make([]io.Reader, len(inputs))
+				for j, input := range inputs {
+					readers[j] = strings.NewReader(input)
+				}
+				ch, err := Merge(context.Background(), readers, Options{Buffer: buffer})
+				if err != nil {
+					b.Fatal(err)
+				}
+				for range ch {
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,584 @@
+package logmerge
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pattern finds a timestamp in a log line with Regex and parses the match
+// with Layout, a Go time layout or one of the special layouts. If Regex has a
+// group named ts, only that part of the match is the timestamp, e.g. to
+// require a prefix that stays in the message. Name optionally describes the
+// format, e.g. "syslog".
+type Pattern struct {
+	Regex  *regexp.Regexp
+	Layout string
+	Name   string
+}
+
+// find returns the location of the timestamp of p in line, or nil.
+func (p Pattern) find(line string) []int {
+	group := p.Regex.SubexpIndex("ts")
+	if group < 0 {
+		return p.Regex.FindStringIndex(line)
+	}
+	loc := p.Regex.FindStringSubmatchIndex(line)
+	if loc == nil || loc[2*group] < 0 {
+		return nil
+	}
+	return loc[2*group : 2*group+2]
+}
+
+// timestampPatterns are the built-in patterns. fastMatch refers to the first
+// ones by index.
+var timestampPatterns = []Pattern{
+	{regexp.MustCompile(`([A-Za-z]{3} +\d+ \d{2}:\d{2}:\d{2})`), "Jan _2 15:04:05", "syslog"},
+	{regexp.MustCompile(`(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} [+-]\d{4})`), "2006-01-02 15:04:05 -0700", "ISO 8601 with offset"},
+	// milliseconds after a comma as by log4j and Python's logging, or after a dot, both of which
+	// time.Parse accepts for the layout's .000, so that a file mixing them keeps a single pattern
+	{regexp.MustCompile(`(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}[.,]\d{3})`), "2006-01-02 15:04:05.000", "ISO 8601 with milliseconds"},
+	{regexp.MustCompile(`(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})`), "2006-01-02 15:04:05", "ISO 8601"},
+	{regexp.MustCompile(`(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}[.,]\d{3})`), "2006-01-02T15:04:05.000", "ISO 8601 T with milliseconds"},
+	{regexp.MustCompile(`(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2})`), "2006-01-02T15:04:05", "ISO 8601 T"},
+	// RFC 5424 syslog: <34>1 2025-06-10T14:30:00.123456Z host app ..., only the timestamp is cut
+	// from the message, the priority, version, hostname and structured data stay
+	{regexp.MustCompile(`^<\d{1,3}>\d{1,2} (?P<ts>\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d{1,6})?(Z|[+-]\d{2}:\d{2})) `), time.RFC3339Nano, "RFC 5424 syslog"},
+	// RFC 3339 with zone, e.g. from Go: 2025-06-10T14:30:00.123456789+02:00 or 2025-06-10T12:30:00Z
+	{regexp.MustCompile(`(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d{1,9})?(Z|[+-]\d{2}:\d{2}))`), time.RFC3339Nano, "RFC 3339"},
+	// journald's short-iso(-precise): 2025-06-10T14:30:00.123456+0200, Go parses the fraction without layout
+	{regexp.MustCompile(`(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d{1,9})?[+-]\d{4})`), "2006-01-02T15:04:05-0700", "journald short-iso"},
+	// compact ISO 8601 from embedded devices: 20250610T143000 or 20250610143000, with a valid
+	// date and time and not part of a longer number, so numeric IDs are not mistaken for them
+	{regexp.MustCompile(`\b(\d{4}(0[1-9]|1[0-2])(0[1-9]|[12]\d|3[01])T([01]\d|2[0-3])[0-5]\d[0-5]\d)\b`), "20060102T150405", "compact ISO 8601 with T"},
+	{regexp.MustCompile(`\b(\d{4}(0[1-9]|1[0-2])(0[1-9]|[12]\d|3[01])([01]\d|2[0-3])[0-5]\d[0-5]\d)\b`), "20060102150405", "compact ISO 8601"},
+	// 12-hour clock of Windows and .NET logs: 06/10/2025 02:30:00 PM or 6/10/2025 2:30:00 PM,
+	// month first unless Options.DateOrder, see dateOrderLayouts
+	{regexp.MustCompile(`\b(\d{1,2}/\d{1,2}/\d{4} \d{1,2}:\d{2}:\d{2} [AP]M)\b`), "1/2/2006 3:04:05 PM", "12-hour clock"},
+	{regexp.MustCompile(`\b(\d{1,2}/\d{1,2}/\d{4} \d{1,2}:\d{2}:\d{2} [ap]m)\b`), "1/2/2006 3:04:05 pm", "12-hour clock, lower case"},
+	// two-digit years of legacy equipment: 25-06-10 14:30:00 year first like ISO, 06/10/25 14:30:00
+	// month first, both unless Options.DateOrder; years 69-99 are 1969-1999, 00-68 are 2000-2068
+	{regexp.MustCompile(`\b(\d{2}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})\b`), "06-01-02 15:04:05", "two-digit year, dashes"},
+	{regexp.MustCompile(`\b(\d{2}/\d{2}/\d{2} \d{2}:\d{2}:\d{2})\b`), "01/02/06 15:04:05", "two-digit year, slashes"},
+	// klog/glog of Kubernetes: I0610 14:30:00.123456, without year; the severity letter I, W, E or F
+	// stays in the message
+	{regexp.MustCompile(`^[IWEF](?P<ts>\d{4} \d{2}:\d{2}:\d{2}\.\d{6})\b`), "0102 15:04:05.000000", "klog"},
+	// Android logcat: 06-10 14:30:00.123  1234  5678 I Tag: msg of the threadtime format, also
+	// the time format; without year, the pid, tid, priority and tag stay in the message
+	{regexp.MustCompile(`^(\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3})\b`), "01-02 15:04:05.000", "Android logcat"},
+	// Apache/nginx access logs: [10/Oct/2000:13:55:36 -0700], the brackets are part of the
+	// timestamp so they are not left behind in the message; some write a space after the date
+	{regexp.MustCompile(`(\[\d{2}/[A-Za-z]{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\])`), "[02/Jan/2006:15:04:05 -0700]", "Apache/nginx access log"},
+	{regexp.MustCompile(`(\[\d{2}/[A-Za-z]{3}/\d{4} \d{2}:\d{2}:\d{2} [+-]\d{4}\])`), "[02/Jan/2006 15:04:05 -0700]", "Apache/nginx access log, blank"},
+	{regexp.MustCompile(`(\d{2}/[A-Za-z]{3}/\d{4} \d{2}:\d{2}:\d{2})`), "02/Jan/2006 15:04:05", "day, month name, year"},
+	{regexp.MustCompile(`(\d{2}/[A-Za-z]{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4})`), "02/Jan/2006:15:04:05 -0700", "day, month name, year with offset"},
+	{regexp.MustCompile(`(\d{2}:\d{2}:\d{2}\.\d{6})`), "15:04:05.000000", "time with microseconds"},
+	{regexp.MustCompile(`(\d+) (\d{2}:\d{2}:\d{2}\.\d{6})`), "15:04:05.000000", "strace"},
+	// date(1) and Go's UnixDate: Mon Jun 10 14:30:00 MST 2025, the zone abbreviation is resolved
+	// by resolveZone, the year at the end by the layout
+	{regexp.MustCompile(`\b([A-Z][a-z]{2} [A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2} [A-Z]{2,5} \d{4})\b`), time.UnixDate, "date(1)"},
+	// ISO 8601 ordinal dates of scientific instruments: 2025-161T14:30:00, the 161st day of 2025,
+	// and week dates: 2025-W24-2 or 2025-W24-2T14:30:00, Tuesday of the 24th week of 2025
+	{regexp.MustCompile(`\b(\d{4}-\d{3}T\d{2}:\d{2}:\d{2}([.,]\d{1,9})?)\b`), "2006-002T15:04:05", "ISO 8601 ordinal date"},
+	{regexp.MustCompile(`\b(\d{4}-W\d{2}-[1-7](T\d{2}:\d{2}:\d{2}([.,]\d{1,9})?)?)\b`), ISOWeekLayout, "ISO 8601 week date"},
+	// epoch timestamps only at the start of a line, so numbers in the message are not mistaken for them
+	{regexp.MustCompile(`^(\d{10}(\.\d{1,9})?)\b`), EpochSecondsLayout, "Unix epoch seconds"},
+	{regexp.MustCompile(`^(\d{13})\b`), EpochMillisLayout, "Unix epoch milliseconds"},
+}
+
+// DateOrder is the order of day, month and year in numeric dates like
+// 06/10/2025, which cannot be told apart for the first twelve days of a
+// month, so it is up to the user.
+type DateOrder string
+
+const (
+	MonthDayYear DateOrder = "mdy"
+	DayMonthYear DateOrder = "dmy"
+	YearMonthDay DateOrder = "ymd"
+)
+
+// numericDatePatterns are the built-in patterns of numeric dates with slashes
+// and a 24-hour clock per DateOrder: 06/10/2025 14:30:00 or 2025/06/10
+// 14:30:00, also with single digit month or day and a fraction. Without
+// Options.DateOrder they are not tried, rather than guessing.
+var numericDatePatterns = map[DateOrder]Pattern{
+	MonthDayYear: {regexp.MustCompile(`\b(\d{1,2}/\d{1,2}/\d{4} \d{2}:\d{2}:\d{2}([.,]\d{1,9})?)\b`), "1/2/2006 15:04:05", "numeric date, month first"},
+	DayMonthYear: {regexp.MustCompile(`\b(\d{1,2}/\d{1,2}/\d{4} \d{2}:\d{2}:\d{2}([.,]\d{1,9})?)\b`), "2/1/2006 15:04:05", "numeric date, day first"},
+	YearMonthDay: {regexp.MustCompile(`\b(\d{4}/\d{1,2}/\d{1,2} \d{2}:\d{2}:\d{2}([.,]\d{1,9})?)\b`), "2006/1/2 15:04:05", "numeric date, year first"},
+}
+
+// dateOrderLayouts replace the layouts of the built-in patterns of numeric
+// dates per Options.DateOrder. Those with four-digit years at the end stay
+// month first with YearMonthDay.
+var dateOrderLayouts = map[DateOrder]map[string]string{
+	MonthDayYear: {
+		"06-01-02 15:04:05": "01-02-06 15:04:05",
+	},
+	DayMonthYear: {
+		"1/2/2006 3:04:05 PM": "2/1/2006 3:04:05 PM",
+		"1/2/2006 3:04:05 pm": "2/1/2006 3:04:05 pm",
+		"06-01-02 15:04:05":   "02-01-06 15:04:05",
+		"01/02/06 15:04:05":   "02/01/06 15:04:05",
+	},
+	YearMonthDay: {
+		"01/02/06 15:04:05": "06/01/02 15:04:05",
+	},
+}
+
+// Special layouts for numeric Unix epoch timestamps and ISO 8601 week dates,
+// which time.Parse cannot handle. They can also be used in a patterns file.
+const (
+	EpochSecondsLayout = "unix"    // seconds, optionally with a fraction: 1718030400.123
+	EpochMillisLayout  = "unixms"  // milliseconds: 1718030400123
+	ISOWeekLayout      = "isoweek" // week date, optionally with a time: 2025-W24-2T14:30:00.123
+)
+
+// parseTimestamp parses value according to layout, which is either a Go time
+// layout or one of the special layouts. Timestamps without zone are taken to
+// be in location, zone abbreviations like MST are resolved with zones, see
+// resolveZone.
+func parseTimestamp(layout, value string, location *time.Location, zones map[string]*time.Location) (time.Time, error) {
+	switch layout {
+	case ISOWeekLayout:
+		return parseISOWeek(value, location)
+	case EpochSecondsLayout:
+		seconds, fraction, _ := strings.Cut(value, ".")
+		sec, err := strconv.ParseInt(seconds, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		var nsec int64
+		if fraction != "" {
+			nsec, err = strconv.ParseInt((fraction + "000000000")[:9], 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+		}
+		return time.Unix(sec, nsec).UTC(), nil
+	case EpochMillisLayout:
+		msec, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.UnixMilli(msec).UTC(), nil
+	}
+	t, err := time.ParseInLocation(layout, value, location)
+	if err != nil || !strings.Contains(layout, "MST") {
+		return t, err
+	}
+	return resolveZone(t, location, zones)
+}
+
+// defaultZoneAbbreviations are the offsets of common zone abbreviations,
+// which are ambiguous, e.g. CST is also China Standard Time. These are the
+// European and US ones.
+var defaultZoneAbbreviations = map[string]*time.Location{
+	"UTC":  time.UTC,
+	"GMT":  time.FixedZone("GMT", 0),
+	"WET":  time.FixedZone("WET", 0),
+	"WEST": time.FixedZone("WEST", 1*3600),
+	"BST":  time.FixedZone("BST", 1*3600),
+	"CET":  time.FixedZone("CET", 1*3600),
+	"CEST": time.FixedZone("CEST", 2*3600),
+	"EET":  time.FixedZone("EET", 2*3600),
+	"EEST": time.FixedZone("EEST", 3*3600),
+	"EST":  time.FixedZone("EST", -5*3600),
+	"EDT":  time.FixedZone("EDT", -4*3600),
+	"CST":  time.FixedZone("CST", -6*3600),
+	"CDT":  time.FixedZone("CDT", -5*3600),
+	"MST":  time.FixedZone("MST", -7*3600),
+	"MDT":  time.FixedZone("MDT", -6*3600),
+	"PST":  time.FixedZone("PST", -8*3600),
+	"PDT":  time.FixedZone("PDT", -7*3600),
+	"AKST": time.FixedZone("AKST", -9*3600),
+	"AKDT": time.FixedZone("AKDT", -8*3600),
+	"HST":  time.FixedZone("HST", -10*3600),
+}
+
+// resolveZone gives t, parsed with a zone abbreviation, the offset of the
+// abbreviation in zones, else in location, else in defaultZoneAbbreviations.
+// time.Parse alone would take an abbreviation unknown to location as UTC.
+func resolveZone(t time.Time, location *time.Location, zones map[string]*time.Location) (time.Time, error) {
+	name, _ := t.Zone()
+	zone, found := zones[name]
+	if !found {
+		if t.Location() == location || t.Location() == time.UTC {
+			return t, nil
+		}
+		if zone, found = defaultZoneAbbreviations[name]; !found {
+			return time.Time{}, fmt.Errorf("unknown zone abbreviation %q", name)
+		}
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), zone), nil
+}
+
+// parseISOWeek parses an ISO 8601 week date like 2025-W24-2, the Tuesday of
+// the 24th week of 2025, optionally followed by a time like T14:30:00.123.
+// Week 1 is the week with the first Thursday of the year.
+func parseISOWeek(value string, location *time.Location) (time.Time, error) {
+	date, clock, hasClock := strings.Cut(value, "T")
+	if len(date) != 10 || date[4:6] != "-W" || date[8] != '-' {
+		return time.Time{}, fmt.Errorf("invalid ISO week date %q", value)
+	}
+	year, errYear := strconv.Atoi(date[:4])
+	week, errWeek := strconv.Atoi(date[6:8])
+	day, errDay := strconv.Atoi(date[9:])
+	if errYear != nil || errWeek != nil || errDay != nil || day < 1 || day > 7 {
+		return time.Time{}, fmt.Errorf("invalid ISO week date %q", value)
+	}
+	// the Monday of week 1, which holds January 4
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, location)
+	t := jan4.AddDate(0, 0, -(int(jan4.Weekday())+6)%7+(week-1)*7+day-1)
+	if y, w := t.ISOWeek(); y != year || w != week {
+		return time.Time{}, fmt.Errorf("week out of range in %q", value)
+	}
+	if hasClock {
+		c, err := time.Parse("15:04:05", clock)
+		if err != nil {
+			return time.Time{}, err
+		}
+		t = time.Date(t.Year(), t.Month(), t.Day(), c.Hour(), c.Minute(), c.Second(), c.Nanosecond(), location)
+	}
+	return t, nil
+}
+
+// ValidateLayout formats a sample time with layout and parses it back, so
+// that a layout without any time fields or one that cannot be read back is
+// reported before processing begins.
+func ValidateLayout(layout string) error {
+	sample := time.Date(2024, time.July, 16, 20, 17, 40, 123456789, time.UTC)
+	formatted := sample.Format(layout)
+	if formatted == layout {
+		return fmt.Errorf("time layout %q contains no time fields", layout)
+	}
+	if _, err := time.Parse(layout, formatted); err != nil {
+		return fmt.Errorf("invalid time layout %q: %w", layout, err)
+	}
+	return nil
+}
+
+// LoadPatterns reads user defined patterns from filename, one
+// "regex<TAB>layout" per line, to be used as Options.Patterns. Blank lines
+// and lines starting with # are ignored. The patterns are named file:line.
+func LoadPatterns(filename string) ([]Pattern, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []Pattern
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		expr, layout, found := strings.Cut(line, "\t")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: expected regex<TAB>layout", filename, lineNo)
+		}
+		regex, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", filename, lineNo, err)
+		}
+		if layout != EpochSecondsLayout && layout != EpochMillisLayout && layout != ISOWeekLayout {
+			if err := ValidateLayout(layout); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", filename, lineNo, err)
+			}
+		}
+		patterns = append(patterns, Pattern{Regex: regex, Layout: layout, Name: fmt.Sprintf("%s:%d", filename, lineNo)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+var NoTimestampError = errors.New("no Timestamp in Line")
+var EndOfFileError = errors.New("end of file")
+
+// Errors that end reading an input with Options.RequireTimestamps and
+// Options.SkipBinary.
+var NoTimestampsFoundError = errors.New("no timestamp found")
+var BinaryFileError = errors.New("binary file")
+
+// fastMatch recognizes the most common timestamps at the very start of line
+// by their shape, without running the regular expressions: ISO dates like
+// "2006-01-02 15:04:05", also with T, milliseconds or an offset, and syslog's
+// "Jan _2 15:04:05", as well as RFC 3339 and offsets without colon. It returns
+// the index of the matching pattern in timestampPatterns and the length of the
+// timestamp, or -1.
+func fastMatch(line string) (index, length int) {
+	switch {
+	case matchShape(line, "dddd-dd-dd dd:dd:dd"):
+		switch {
+		case matchShape(line[19:], " sdddd"):
+			return 1, 25
+		case matchShape(line[19:], ",ddd"), matchShape(line[19:], ".ddd"):
+			return 2, 23
+		}
+		return 3, 19
+	case matchShape(line, "dddd-dd-ddTdd:dd:dd"):
+		if index, n := zoneSuffix(line[19:]); n > 0 {
+			return index, 19 + n
+		}
+		switch {
+		case matchShape(line[19:], ",ddd"), matchShape(line[19:], ".ddd"):
+			return 4, 23
+		}
+		return 5, 19
+	case matchShape(line, "aaa "):
+		i := 4
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		j := i
+		for j < len(line) && '0' <= line[j] && line[j] <= '9' {
+			j++
+		}
+		if j > i && matchShape(line[j:], " dd:dd:dd") {
+			return 0, j + 9
+		}
+	}
+	return -1, 0
+}
+
+// zoneSuffix returns the pattern index and the length of the optional
+// fraction and the zone at the start of s: an RFC 3339 zone, or an offset
+// without colon as in journald's short-iso-precise. The length is 0 if there
+// is no zone.
+func zoneSuffix(s string) (index, length int) {
+	i := 0
+	if strings.HasPrefix(s, ".") {
+		i = 1
+		for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+			i++
+		}
+		if i == 1 || i > 10 {
+			return 0, 0
+		}
+	}
+	switch {
+	case strings.HasPrefix(s[i:], "Z"):
+		return 7, i + 1
+	case matchShape(s[i:], "sdd:dd"):
+		return 7, i + 6
+	case matchShape(s[i:], "sdddd"):
+		return 8, i + 5
+	}
+	return 0, 0
+}
+
+// matchShape reports whether s starts with shape, in which d stands for a
+// digit, a for an ASCII letter, s for a + or - sign and any other character
+// for itself.
+func matchShape(s, shape string) bool {
+	if len(s) < len(shape) {
+		return false
+	}
+	for i := 0; i < len(shape); i++ {
+		c := s[i]
+		switch shape[i] {
+		case 'd':
+			if c < '0' || c > '9' {
+				return false
+			}
+		case 'a':
+			if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+				return false
+			}
+		case 's':
+			if c != '+' && c != '-' {
+				return false
+			}
+		default:
+			if c != shape[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (m *merger) findBestMatch(line string) (index int, resLoc []int, err error) {
+	return bestMatch(m.patterns, line)
+}
+
+// bestMatch returns the index and location of the leftmost match of patterns
+// in line, the longest one if several start there, the first pattern if they
+// are equally long. It returns NoTimestampError if none matches.
+func bestMatch(patterns []Pattern, line string) (index int, resLoc []int, err error) {
+	err = NoTimestampError
+	for i, pattern := range patterns {
+		loc := pattern.find(line)
+		if loc == nil {
+			continue
+		}
+		if resLoc == nil || loc[0] < resLoc[0] || (loc[0] == resLoc[0] && loc[1] > resLoc[1]) {
+			resLoc = loc
+			index = i
+			err = nil
+		}
+	}
+	return
+}
+
+// yearState tracks the year of year-less (e.g. syslog) timestamps of a file.
+type yearState struct {
+	reference time.Time // modification time of the file, the newest a line can be
+	year      int       // year of the previous year-less timestamp, 0 before the first one
+	lastMonth time.Month
+}
+
+// addYear sets the year of a year-less timestamp. The first one gets the year
+// of the file modification time (or of now, e.g. for stdin), minus one if it
+// would otherwise lie after it. After that the year is bumped whenever the
+// month decreases, which is a Dec -> Jan rollover in a sorted file.
+func (r *reader) addYear(timestamp time.Time) time.Time {
+	if r.year == nil {
+		r.year = &yearState{reference: time.Now()}
+	}
+	state := r.year
+	if state.year == 0 {
+		state.year = state.reference.Year()
+		// allow a day of slack for timestamps logged in a timezone ahead of Options.Location
+		if timestamp.AddDate(state.year, 0, 0).After(state.reference.Add(24 * time.Hour)) {
+			state.year--
+		}
+	} else if timestamp.Month() < state.lastMonth {
+		state.year++
+	}
+	state.lastMonth = timestamp.Month()
+	return timestamp.AddDate(state.year, 0, 0)
+}
+
+func (r *reader) extractTimestamp(line string, loc []int, layout string) (Line, error) {
+	timestamp, err := parseTimestamp(layout, line[loc[0]:loc[1]], r.location, r.m.opts.ZoneAbbreviations)
+	if err != nil {
+		return Line{RestOfLine: line}, NoTimestampError
+	}
+	if timestamp.Year() == 0 {
+		timestamp = r.addYear(timestamp)
+	}
+	return Line{
+		Timestamp:    timestamp,
+		RawTimestamp: line[loc[0]:loc[1]],
+		RawOffset:    loc[0],
+		RestOfLine:   line[:loc[0]] + line[loc[1]:],
+	}, nil
+}
+
+// recentPatterns is how many of the patterns that last matched an input are
+// tried first, so that inputs mixing a few timestamp formats stay fast.
+const recentPatterns = 4
+
+// remember moves the pattern index to the front of the recent patterns.
+func (r *reader) remember(index int) {
+	i := slices.Index(r.recent, index)
+	if i < 0 {
+		if len(r.recent) < recentPatterns {
+			r.recent = append(r.recent, 0)
+		}
+		i = len(r.recent) - 1
+	}
+	copy(r.recent[1:i+1], r.recent[:i])
+	r.recent[0] = index
+}
+
+// parseLogLine finds and parses the timestamp of line. cacheHit reports
+// whether one of the patterns that recently matched the input did.
+func (r *reader) parseLogLine(line string) (parsed Line, cacheHit bool, err error) {
+	m := r.m
+	for _, parser := range m.opts.Parsers {
+		if timestamp, rest, err := parser.Parse(line); err == nil {
+			if timestamp.Year() == 0 {
+				timestamp = r.addYear(timestamp)
+			}
+			return parserLine(line, timestamp, rest), false, nil
+		}
+	}
+	// the part of line to search, at offset in line
+	text, offset := line, 0
+	if to := m.opts.TimestampTo; to > 0 && len(line) >= to {
+		text, offset = line[m.opts.TimestampFrom:to], m.opts.TimestampFrom
+	}
+	for _, index := range r.recent {
+		pattern := m.patterns[index]
+		if loc := pattern.find(text); loc != nil {
+			if parsed, err := r.extractTimestamp(line, []int{offset + loc[0], offset + loc[1]}, pattern.Layout); err == nil {
+				r.remember(index)
+				return parsed, true, nil
+			}
+		}
+	}
+
+	// a common timestamp at the start of the line needs no regular expressions,
+	// unless user defined patterns take precedence
+	if len(m.opts.Patterns) == 0 {
+		if index, length := fastMatch(text); index >= 0 {
+			parsed, err := r.extractTimestamp(line, []int{offset, offset + length}, m.patterns[index].Layout)
+			if err == nil {
+				r.remember(index)
+				return parsed, false, nil
+			}
+		}
+	}
+
+	patternIndex, loc, err := m.findBestMatch(text)
+	if err == nil {
+		parsed, err := r.extractTimestamp(line, []int{offset + loc[0], offset + loc[1]}, m.patterns[patternIndex].Layout)
+		if err == nil {
+			r.remember(patternIndex)
+		}
+		return parsed, false, err
+	}
+	return Line{RestOfLine: line}, false, NoTimestampError
+}
+
+func (r *reader) readNextTimestamp() (Line, error) {
+	for r.scanner.Scan() {
+		parsed, cacheHit, err := r.parseLogLine(r.scanner.Text())
+		r.mu.Lock()
+		r.stats.Lines++
+		parsed.LineNo = r.stats.Lines
+		if cacheHit {
+			r.stats.CacheHits++
+		}
+		if err == nil {
+			if !cacheHit {
+				r.stats.CacheMisses++
+			}
+			if r.stats.First.IsZero() {
+				r.stats.First = parsed.Timestamp
+			}
+			r.stats.Last = parsed.Timestamp
+		} else {
+			r.stats.NoTimestamp++
+		}
+		r.mu.Unlock()
+		return parsed, err
+	}
+	if err := r.scanner.Err(); err != nil {
+		lines := r.fileStats().Lines
+		if errors.Is(err, bufio.ErrTooLong) {
+			return Line{}, fmt.Errorf("line %d is longer than %d bytes: %w", lines+1, r.m.opts.MaxLineLength, err)
+		}
+		return Line{}, fmt.Errorf("after line %d: %w", lines, err)
+	}
+	return Line{}, EndOfFileError
+}
+
+// isReadError reports whether err is an actual error reading a file, as
+// opposed to its end or a line without timestamp.
+func isReadError(err error) bool {
+	return err != nil && !errors.Is(err, EndOfFileError) && !errors.Is(err, NoTimestampError)
+}
@@ -0,0 +1,469 @@
+package logmerge
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestReader returns a reader of input with opts, as Merge creates it.
+func newTestReader(tb testing.TB, opts Options, input string) *reader {
+	tb.Helper()
+	m, err := newMerger([]io.Reader{nil}, opts)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return m.newReader(0, strings.NewReader(input))
+}
+
+// parseTest is a line and the timestamp, in time.RFC3339Nano, the matched
+// text and the rest of the line it parses into. An empty timestamp expects
+// NoTimestampError.
+type parseTest struct {
+	line, timestamp, raw, rest string
+}
+
+// checkParse parses the lines of tests with opts, with a modification time in
+// June 2025 for the timestamps without year.
+func checkParse(t *testing.T, opts Options, tests []parseTest) {
+	t.Helper()
+	if opts.ModTimes == nil {
+		opts.ModTimes = []time.Time{time.Date(2025, time.June, 11, 0, 0, 0, 0, time.UTC)}
+	}
+	for _, tt := range tests {
+		r := newTestReader(t, opts, "")
+		parsed, _, err := r.parseLogLine(tt.line)
+		if tt.timestamp == "" {
+			if !errors.Is(err, NoTimestampError) {
+				t.Errorf("%q: got %s from %q, want no timestamp", tt.line, parsed.Timestamp.Format(time.RFC3339Nano), parsed.RawTimestamp)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.line, err)
+			continue
+		}
+		if got := parsed.Timestamp.Format(time.RFC3339Nano); got != tt.timestamp || parsed.RawTimestamp != tt.raw || parsed.RestOfLine != tt.rest {
+			t.Errorf("%q: got %s from %q, rest %q, want %s from %q, rest %q", tt.line, got, parsed.RawTimestamp, parsed.RestOfLine,
+				tt.timestamp, tt.raw, tt.rest)
+		}
+		if parsed.OriginalLine() != tt.line {
+			t.Errorf("%q: original line %q", tt.line, parsed.OriginalLine())
+		}
+	}
+}
+
+func TestFastMatchAgreesWithPatterns(t *testing.T) {
+	m := &merger{patterns: timestampPatterns}
+	tests := []struct {
+		line string
+		fast bool // fastMatch recognizes it
+	}{
+		{"Jun 10 14:30:00 host app: msg", true},
+		{"Jun  1 14:30:00 host app: msg", true},
+		{"2025-06-10 14:30:00 +0200 msg", true},
+		{"2025-06-10 14:30:00,123 msg", true},
+		{"2025-06-10 14:30:00.123 msg", true},
+		{"2025-06-10 14:30:00 msg", true},
+		{"2025-06-10T14:30:00.123 msg", true},
+		{"2025-06-10T14:30:00,123 msg", true},
+		{"2025-06-10T14:30:00 msg", true},
+		{"2025-06-10T14:30:00Z msg", true},
+		{"2025-06-10T14:30:00.123456789+02:00 msg", true},
+		{"2025-06-10T14:30:00-07:00 msg", true},
+		{"2025-06-10T14:30:00.123456+0200 msg", true},
+		{"2025-06-10T14:30:00+0200 msg", true},
+		{"<34>1 2025-06-10T14:30:00.123456Z host app - - - msg", false},
+		{"20250610T143000 msg", false},
+		{"20250610143000 msg", false},
+		{"06/10/2025 02:30:00 PM msg", false},
+		{"6/10/2025 2:30:00 pm msg", false},
+		{"25-06-10 14:30:00 msg", false},
+		{"06-10-25 14:30:00 msg", false},
+		{"06/10/25 14:30:00 msg", false},
+		{"I0610 14:30:00.123456   123 main.go:42] msg", false},
+		{"06-10 14:30:00.123  1234  5678 I Tag: msg", false},
+		{`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200`, false},
+		{`127.0.0.1 - - [10/Oct/2000 13:55:36 -0700] "GET / HTTP/1.0" 200`, false},
+		{"10/Oct/2000 13:55:36 msg", false},
+		{"10/Oct/2000:13:55:36 -0700 msg", false},
+		{"14:30:00.123456 msg", false},
+		{"1234 14:30:00.123456 write(1, ...)", false},
+		{"Tue Jun 10 14:30:00 MST 2025 msg", false},
+		{"2025-161T14:30:00 msg", false},
+		{"2025-W24-2T14:30:00 msg", false},
+		{"1749591000.123 msg", false},
+		{"1749591000123 msg", false},
+	}
+	for _, tt := range tests {
+		index, loc, err := m.findBestMatch(tt.line)
+		if err != nil {
+			t.Errorf("%q: no pattern matches", tt.line)
+			continue
+		}
+		fastIndex, length := fastMatch(tt.line)
+		if (fastIndex >= 0) != tt.fast {
+			t.Errorf("%q: fastMatch = %d, want fast path %v", tt.line, fastIndex, tt.fast)
+			continue
+		}
+		if fastIndex >= 0 && (fastIndex != index || loc[0] != 0 || loc[1] != length) {
+			t.Errorf("%q: fastMatch = %d, %q, patterns give %d, %q", tt.line, fastIndex, tt.line[:length],
+				index, tt.line[loc[0]:loc[1]])
+		}
+	}
+}
+
+func BenchmarkParseLogLine(b *testing.B) {
+	lines := []struct{ name, line string }{
+		{"iso", "2025-06-10 14:30:00.123 INFO server started on port 8080"},
+		{"rfc3339", "2025-06-10T14:30:00.123456789+02:00 level=info msg=started"},
+		{"syslog", "Jun 10 14:30:00 host sshd[123]: Accepted publickey for root"},
+		{"apache", `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200 2326`},
+		{"none", "    at com.example.Server.start(Server.java:42)"},
+	}
+	for _, l := range lines {
+		b.Run(l.name, func(b *testing.B) {
+			r := newTestReader(b, Options{}, "")
+			for i := 0; i < b.N; i++ {
+				_, _, _ = r.parseLogLine(l.line)
+			}
+		})
+	}
+}
+
+// BenchmarkMatch compares finding the timestamp of lines the fast path
+// recognizes with fastMatch and with the leftmost longest match of
+// findBestMatch.
+func BenchmarkMatch(b *testing.B) {
+	m := &merger{patterns: timestampPatterns}
+	lines := []struct{ name, line string }{
+		{"iso", "2025-06-10 14:30:00.123 INFO server started on port 8080"},
+		{"isoT", "2025-06-10T14:30:00.123 level=info msg=started"},
+		{"syslog", "Jun 10 14:30:00 host sshd[123]: Accepted publickey for root"},
+	}
+	for _, l := range lines {
+		b.Run("fast/"+l.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if index, _ := fastMatch(l.line); index < 0 {
+					b.Fatal("no match")
+				}
+			}
+		})
+		b.Run("best/"+l.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, _, err := m.findBestMatch(l.line); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRFC3339(t *testing.T) {
+	checkParse(t, Options{}, []parseTest{
+		{"2025-06-10T14:30:00Z msg", "2025-06-10T14:30:00Z", "2025-06-10T14:30:00Z", " msg"},
+		{"2025-06-10T14:30:00+00:00 msg", "2025-06-10T14:30:00Z", "2025-06-10T14:30:00+00:00", " msg"},
+		{"2025-06-10T14:30:00-07:00 msg", "2025-06-10T14:30:00-07:00", "2025-06-10T14:30:00-07:00", " msg"},
+		{"2025-06-10T14:30:00.123456789+02:00 msg", "2025-06-10T14:30:00.123456789+02:00", "2025-06-10T14:30:00.123456789+02:00", " msg"},
+		{"2025-06-10T14:30:00.5Z msg", "2025-06-10T14:30:00.5Z", "2025-06-10T14:30:00.5Z", " msg"},
+		// the nanoseconds and zone, not the shorter match without them
+		{"ts=2025-06-10T14:30:00.000000001-07:00 msg", "2025-06-10T14:30:00.000000001-07:00", "2025-06-10T14:30:00.000000001-07:00", "ts= msg"},
+	})
+	// the zone of the line wins over Options.Location
+	checkParse(t, Options{Location: time.FixedZone("CET", 3600)}, []parseTest{
+		{"2025-06-10T14:30:00Z msg", "2025-06-10T14:30:00Z", "2025-06-10T14:30:00Z", " msg"},
+		{"2025-06-10T14:30:00-07:00 msg", "2025-06-10T14:30:00-07:00", "2025-06-10T14:30:00-07:00", " msg"},
+	})
+	// the same instant in three forms, ordered by the instant and then by input
+	checkLines(t, merge(t, Options{},
+		"2025-06-10T14:30:00Z a0\n2025-06-10T14:30:02.000000001Z a2\n2025-06-10T21:30:03Z a3\n",
+		"2025-06-10T14:30:00+00:00 b0\n2025-06-10T14:30:01+00:00 b1\n2025-06-10T14:30:03+00:00 b3\n",
+		"2025-06-10T07:30:00-07:00 c0\n2025-06-10T07:30:02-07:00 c2\n2025-06-10T07:30:04-07:00 c4\n"), []string{
+		"a: 2025-06-10T14:30:00Z a0",
+		"b: 2025-06-10T14:30:00+00:00 b0",
+		"c: 2025-06-10T07:30:00-07:00 c0",
+		"b: 2025-06-10T14:30:01+00:00 b1",
+		"c: 2025-06-10T07:30:02-07:00 c2",
+		"a: 2025-06-10T14:30:02.000000001Z a2",
+		"b: 2025-06-10T14:30:03+00:00 b3",
+		"c: 2025-06-10T07:30:04-07:00 c4",
+		"a: 2025-06-10T21:30:03Z a3",
+	})
+}
+
+func TestParseAccessLog(t *testing.T) {
+	checkParse(t, Options{}, []parseTest{
+		{`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200`,
+			"2000-10-10T13:55:36-07:00", "[10/Oct/2000:13:55:36 -0700]", `127.0.0.1 - -  "GET / HTTP/1.0" 200`},
+		{`127.0.0.1 - - [10/Oct/2000 13:55:36 -0700] "GET / HTTP/1.0" 200`,
+			"2000-10-10T13:55:36-07:00", "[10/Oct/2000 13:55:36 -0700]", `127.0.0.1 - -  "GET / HTTP/1.0" 200`},
+		{`[10/Oct/2000:13:55:36 +0000] "GET / HTTP/1.0" 200`,
+			"2000-10-10T13:55:36Z", "[10/Oct/2000:13:55:36 +0000]", ` "GET / HTTP/1.0" 200`},
+		{"10/Oct/2000:13:55:36 -0700 msg", "2000-10-10T13:55:36-07:00", "10/Oct/2000:13:55:36 -0700", " msg"},
+	})
+}
+
+func TestParse12Hour(t *testing.T) {
+	checkParse(t, Options{}, []parseTest{
+		{"06/10/2025 02:30:00 PM msg", "2025-06-10T14:30:00Z", "06/10/2025 02:30:00 PM", " msg"},
+		{"6/10/2025 2:30:00 pm msg", "2025-06-10T14:30:00Z", "6/10/2025 2:30:00 pm", " msg"},
+		{"06/10/2025 12:00:00 AM msg", "2025-06-10T00:00:00Z", "06/10/2025 12:00:00 AM", " msg"},
+		{"06/10/2025 12:30:00 am msg", "2025-06-10T00:30:00Z", "06/10/2025 12:30:00 am", " msg"},
+		{"06/10/2025 12:00:00 PM msg", "2025-06-10T12:00:00Z", "06/10/2025 12:00:00 PM", " msg"},
+		{"13/10/2025 02:30:00 PM msg", "", "", ""},
+	})
+	checkParse(t, Options{DateOrder: DayMonthYear}, []parseTest{
+		{"06/10/2025 02:30:00 PM msg", "2025-10-06T14:30:00Z", "06/10/2025 02:30:00 PM", " msg"},
+		{"13/10/2025 02:30:00 PM msg", "2025-10-13T14:30:00Z", "13/10/2025 02:30:00 PM", " msg"},
+	})
+}
+
+func TestParseTwoDigitYears(t *testing.T) {
+	tests := []struct {
+		name  string
+		order DateOrder
+		want  []parseTest
+	}{
+		{"default", "", []parseTest{
+			{"25-06-10 14:30:00 msg", "2025-06-10T14:30:00Z", "25-06-10 14:30:00", " msg"},
+			{"06/10/25 14:30:00 msg", "2025-06-10T14:30:00Z", "06/10/25 14:30:00", " msg"},
+			{"99-12-31 23:59:59 msg", "1999-12-31T23:59:59Z", "99-12-31 23:59:59", " msg"},
+			{"06-10-25 14:30:00 msg", "2006-10-25T14:30:00Z", "06-10-25 14:30:00", " msg"},
+		}},
+		{"mdy", MonthDayYear, []parseTest{
+			{"06-10-25 14:30:00 msg", "2025-06-10T14:30:00Z", "06-10-25 14:30:00", " msg"},
+			{"06/10/25 14:30:00 msg", "2025-06-10T14:30:00Z", "06/10/25 14:30:00", " msg"},
+			{"13-06-25 14:30:00 msg", "", "", ""},
+		}},
+		{"dmy", DayMonthYear, []parseTest{
+			{"10-06-25 14:30:00 msg", "2025-06-10T14:30:00Z", "10-06-25 14:30:00", " msg"},
+			{"10/06/25 14:30:00 msg", "2025-06-10T14:30:00Z", "10/06/25 14:30:00", " msg"},
+			{"25-06-10 14:30:00 msg", "2010-06-25T14:30:00Z", "25-06-10 14:30:00", " msg"},
+		}},
+		{"ymd", YearMonthDay, []parseTest{
+			{"25-06-10 14:30:00 msg", "2025-06-10T14:30:00Z", "25-06-10 14:30:00", " msg"},
+			{"25/06/10 14:30:00 msg", "2025-06-10T14:30:00Z", "25/06/10 14:30:00", " msg"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkParse(t, Options{DateOrder: tt.order}, tt.want)
+			// neither the epoch seconds nor logcat's month and day are taken for two-digit years
+			checkParse(t, Options{DateOrder: tt.order}, []parseTest{
+				{"1749565800 msg", "2025-06-10T14:30:00Z", "1749565800", " msg"},
+				{"06-10 14:30:00.123  1234  5678 I Tag: msg", "2025-06-10T14:30:00.123Z", "06-10 14:30:00.123", "  1234  5678 I Tag: msg"},
+				{"2025-06-10 14:30:00 msg", "2025-06-10T14:30:00Z", "2025-06-10 14:30:00", " msg"},
+			})
+		})
+	}
+}
+
+// BenchmarkRecentPatterns compares parsing the lines of an input with and
+// without trying the patterns that recently matched it first.
+func BenchmarkRecentPatterns(b *testing.B) {
+	inputs := []struct {
+		name  string
+		lines []string
+	}{
+		{"apache", []string{
+			`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200 2326`,
+		}},
+		{"mixed", []string{
+			`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200 2326`,
+			"10/Oct/2000 13:55:36 msg",
+			"2025-06-10T14:30:00.123456Z level=info msg=started",
+		}},
+		{"iso", []string{
+			"2025-06-10 14:30:00.123 INFO server started on port 8080",
+		}},
+	}
+	for _, input := range inputs {
+		for _, cached := range []bool{true, false} {
+			name := input.name + "/cached"
+			if !cached {
+				name = input.name + "/uncached"
+			}
+			b.Run(name, func(b *testing.B) {
+				r := newTestReader(b, Options{}, "")
+				for i := 0; i < b.N; i++ {
+					if !cached {
+						r.recent = r.recent[:0]
+					}
+					if _, _, err := r.parseLogLine(input.lines[i%len(input.lines)]); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestParseJournald(t *testing.T) {
+	checkParse(t, Options{}, []parseTest{
+		// short-iso-precise and short-iso
+		{"2025-06-10T14:30:00.123456+0200 host app[1]: msg",
+			"2025-06-10T14:30:00.123456+02:00", "2025-06-10T14:30:00.123456+0200", " host app[1]: msg"},
+		{"2025-06-10T14:30:00+0200 host app[1]: msg", "2025-06-10T14:30:00+02:00", "2025-06-10T14:30:00+0200", " host app[1]: msg"},
+		{"2025-06-10T14:30:00-0700 host app[1]: msg", "2025-06-10T14:30:00-07:00", "2025-06-10T14:30:00-0700", " host app[1]: msg"},
+		// short
+		{"Jun 10 14:30:00 host app[1]: msg", "2025-06-10T14:30:00Z", "Jun 10 14:30:00", " host app[1]: msg"},
+	})
+}
+
+func TestParseTwoTimestamps(t *testing.T) {
+	checkParse(t, Options{}, []parseTest{
+		// the leftmost one
+		{"host 2025-06-10 14:30:00 at Jun 10 14:30:05", "2025-06-10T14:30:00Z", "2025-06-10 14:30:00", "host  at Jun 10 14:30:05"},
+		{"req 2025-06-10 14:30:00 took 2025-06-10T14:30:00.123456Z",
+			"2025-06-10T14:30:00Z", "2025-06-10 14:30:00", "req  took 2025-06-10T14:30:00.123456Z"},
+		{"id=12 2025-06-10T14:30:00.123Z and 2025-06-10 14:30:00",
+			"2025-06-10T14:30:00.123Z", "2025-06-10T14:30:00.123Z", "id=12  and 2025-06-10 14:30:00"},
+		// of those starting there, the longest one
+		{"x 2025-06-10 14:30:00 +0200 y", "2025-06-10T14:30:00+02:00", "2025-06-10 14:30:00 +0200", "x  y"},
+		{"[job 2025-06-10 14:30:00,123] done", "2025-06-10T14:30:00.123Z", "2025-06-10 14:30:00,123", "[job ] done"},
+		{"at 2025-06-10T14:30:00.123456789+02:00 ok", "2025-06-10T14:30:00.123456789+02:00", "2025-06-10T14:30:00.123456789+02:00", "at  ok"},
+	})
+}
+
+func TestParseKlog(t *testing.T) {
+	checkParse(t, Options{}, []parseTest{
+		{"I0610 14:30:00.123456   123 main.go:42] msg", "2025-06-10T14:30:00.123456Z", "0610 14:30:00.123456", "I   123 main.go:42] msg"},
+		{"W0610 14:30:00.123456 123 main.go:42] msg", "2025-06-10T14:30:00.123456Z", "0610 14:30:00.123456", "W 123 main.go:42] msg"},
+		// after the modification time, so of the year before
+		{"E1231 23:59:59.000001    7 x.go:1] boom", "2024-12-31T23:59:59.000001Z", "1231 23:59:59.000001", "E    7 x.go:1] boom"},
+		{"X0610 14:30:00.123456   123 main.go:42] msg", "", "", ""},
+	})
+}
+
+func TestParseRFC5424(t *testing.T) {
+	checkParse(t, Options{}, []parseTest{
+		{`<34>1 2025-06-10T14:30:00.123456Z host app 1234 ID47 [id@32473 key="value"] msg`,
+			"2025-06-10T14:30:00.123456Z", "2025-06-10T14:30:00.123456Z", `<34>1  host app 1234 ID47 [id@32473 key="value"] msg`},
+		{"<165>1 2025-06-10T14:30:00+02:00 host app - - - msg", "2025-06-10T14:30:00+02:00", "2025-06-10T14:30:00+02:00", "<165>1  host app - - - msg"},
+		{"<0>12 2025-06-10T14:30:00.1Z host app - - -", "2025-06-10T14:30:00.1Z", "2025-06-10T14:30:00.1Z", "<0>12  host app - - -"},
+		// the nil value: no timestamp
+		{"<34>1 - host app - - - msg", "", "", ""},
+	})
+}
+
+func TestParseLogcat(t *testing.T) {
+	checkParse(t, Options{}, []parseTest{
+		// threadtime and time formats
+		{"06-10 14:30:00.123  1234  5678 I Tag: msg", "2025-06-10T14:30:00.123Z", "06-10 14:30:00.123", "  1234  5678 I Tag: msg"},
+		{"06-10 14:30:00.123 I/Tag( 1234): msg", "2025-06-10T14:30:00.123Z", "06-10 14:30:00.123", " I/Tag( 1234): msg"},
+		// after the modification time, so of the year before
+		{"12-31 23:59:59.999  1234  5678 E Tag: msg", "2024-12-31T23:59:59.999Z", "12-31 23:59:59.999", "  1234  5678 E Tag: msg"},
+	})
+}
+
+func TestParseMixedFractionSeparators(t *testing.T) {
+	// one reader, as for a file whose logger switches between them
+	lines := []parseTest{
+		{"2025-06-10 14:30:00,123 INFO comma", "2025-06-10T14:30:00.123Z", "2025-06-10 14:30:00,123", " INFO comma"},
+		{"2025-06-10 14:30:00.456 INFO dot", "2025-06-10T14:30:00.456Z", "2025-06-10 14:30:00.456", " INFO dot"},
+		{"2025-06-10 14:30:01,007 INFO comma", "2025-06-10T14:30:01.007Z", "2025-06-10 14:30:01,007", " INFO comma"},
+		{"2025-06-10T14:30:01.500 INFO T dot", "2025-06-10T14:30:01.5Z", "2025-06-10T14:30:01.500", " INFO T dot"},
+		{"2025-06-10T14:30:02,000 INFO T comma", "2025-06-10T14:30:02Z", "2025-06-10T14:30:02,000", " INFO T comma"},
+	}
+	r := newTestReader(t, Options{}, "")
+	patterns := map[int]bool{}
+	for _, tt := range lines {
+		parsed, _, err := r.parseLogLine(tt.line)
+		if err != nil {
+			t.Errorf("%q: %v", tt.line, err)
+			continue
+		}
+		if got := parsed.Timestamp.Format(time.RFC3339Nano); got != tt.timestamp || parsed.RawTimestamp != tt.raw || parsed.RestOfLine != tt.rest {
+			t.Errorf("%q: got %s from %q, rest %q, want %s from %q, rest %q", tt.line, got, parsed.RawTimestamp, parsed.RestOfLine,
+				tt.timestamp, tt.raw, tt.rest)
+		}
+		patterns[r.recent[0]] = true
+	}
+	// one pattern with a space and one with a T, whatever the separator
+	if len(patterns) != 2 {
+		t.Errorf("matched %d patterns, want 2", len(patterns))
+	}
+	checkLines(t, merge(t, Options{},
+		"2025-06-10 14:30:00,100 a comma\n2025-06-10 14:30:00.300 a dot\n2025-06-10 14:30:00,500 a comma\n",
+		"2025-06-10 14:30:00.200 b dot\n2025-06-10 14:30:00,400 b comma\n"), []string{
+		"a: 2025-06-10 14:30:00,100 a comma",
+		"b: 2025-06-10 14:30:00.200 b dot",
+		"a: 2025-06-10 14:30:00.300 a dot",
+		"b: 2025-06-10 14:30:00,400 b comma",
+		"a: 2025-06-10 14:30:00,500 a comma",
+	})
+}
+
+func TestParseISOOrdinalAndWeekDates(t *testing.T) {
+	checkParse(t, Options{}, []parseTest{
+		// ordinal dates
+		{"2025-161T14:30:00 msg", "2025-06-10T14:30:00Z", "2025-161T14:30:00", " msg"},
+		{"2025-001T00:00:00.5 msg", "2025-01-01T00:00:00.5Z", "2025-001T00:00:00.5", " msg"},
+		{"2024-366T23:59:59 msg", "2024-12-31T23:59:59Z", "2024-366T23:59:59", " msg"},
+		{"2025-366T23:59:59 msg", "", "", ""},
+		// week dates, with and without time
+		{"2025-W24-2T14:30:00 msg", "2025-06-10T14:30:00Z", "2025-W24-2T14:30:00", " msg"},
+		{"2025-W24-2T14:30:00,250 msg", "2025-06-10T14:30:00.25Z", "2025-W24-2T14:30:00,250", " msg"},
+		{"2025-W24-2 msg", "2025-06-10T00:00:00Z", "2025-W24-2", " msg"},
+		// week 1 starts in the year before, week 53 ends in the year after
+		{"2025-W01-1 msg", "2024-12-30T00:00:00Z", "2025-W01-1", " msg"},
+		{"2020-W53-5 msg", "2021-01-01T00:00:00Z", "2020-W53-5", " msg"},
+		{"2025-W53-1 msg", "", "", ""},
+		{"2025-W24-8 msg", "", "", ""},
+	})
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	checkParse(t, Options{Location: berlin}, []parseTest{
+		{"2025-161T14:30:00 msg", "2025-06-10T14:30:00+02:00", "2025-161T14:30:00", " msg"},
+		{"2025-W24-2T14:30:00 msg", "2025-06-10T14:30:00+02:00", "2025-W24-2T14:30:00", " msg"},
+	})
+	checkLines(t, merge(t, Options{},
+		"2025-161T14:30:00 ordinal\n2025-161T14:30:03 ordinal\n",
+		"2025-W24-2T14:30:01 week\n2025-W24-2T14:30:04 week\n",
+		"2025-06-10T14:30:02Z iso\n2025-06-10 14:30:05 iso\n"), []string{
+		"a: 2025-161T14:30:00 ordinal",
+		"b: 2025-W24-2T14:30:01 week",
+		"c: 2025-06-10T14:30:02Z iso",
+		"a: 2025-161T14:30:03 ordinal",
+		"b: 2025-W24-2T14:30:04 week",
+		"c: 2025-06-10 14:30:05 iso",
+	})
+}
+
+func TestParseZoneAbbreviations(t *testing.T) {
+	checkParse(t, Options{}, []parseTest{
+		{"Tue Jun 10 14:30:00 MST 2025 msg", "2025-06-10T14:30:00-07:00", "Tue Jun 10 14:30:00 MST 2025", " msg"},
+		{"Tue Jun 10 14:30:00 CEST 2025 msg", "2025-06-10T14:30:00+02:00", "Tue Jun 10 14:30:00 CEST 2025", " msg"},
+		{"Tue Jun 10 14:30:00 UTC 2025 msg", "2025-06-10T14:30:00Z", "Tue Jun 10 14:30:00 UTC 2025", " msg"},
+		{"Sat Jan  4 09:05:00 EST 2025 msg", "2025-01-04T09:05:00-05:00", "Sat Jan  4 09:05:00 EST 2025", " msg"},
+		// ambiguous, so not guessed
+		{"Tue Jun 10 14:30:00 IST 2025 msg", "", "", ""},
+	})
+	// the mapping comes first, then the timezone, then the built-in offsets
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	checkParse(t, Options{Location: newYork, ZoneAbbreviations: map[string]*time.Location{
+		"IST": time.FixedZone("IST", 5*3600+1800),
+		"CST": time.FixedZone("CST", 8*3600),
+	}}, []parseTest{
+		{"Tue Jun 10 14:30:00 IST 2025 msg", "2025-06-10T14:30:00+05:30", "Tue Jun 10 14:30:00 IST 2025", " msg"},
+		{"Tue Jun 10 14:30:00 CST 2025 msg", "2025-06-10T14:30:00+08:00", "Tue Jun 10 14:30:00 CST 2025", " msg"},
+		{"Tue Jun 10 14:30:00 EDT 2025 msg", "2025-06-10T14:30:00-04:00", "Tue Jun 10 14:30:00 EDT 2025", " msg"},
+		{"Tue Jun 10 14:30:00 CEST 2025 msg", "2025-06-10T14:30:00+02:00", "Tue Jun 10 14:30:00 CEST 2025", " msg"},
+	})
+	checkLines(t, merge(t, Options{ZoneAbbreviations: map[string]*time.Location{"IST": time.FixedZone("IST", 5*3600+1800)}},
+		"Tue Jun 10 14:30:00 CEST 2025 berlin\nTue Jun 10 14:30:00 PDT 2025 seattle\n",
+		"Tue Jun 10 08:30:00 EDT 2025 new york\n",
+		"Tue Jun 10 17:30:00 IST 2025 mumbai\n"), []string{
+		"c: Tue Jun 10 17:30:00 IST 2025 mumbai",   // 12:00 UTC
+		"a: Tue Jun 10 14:30:00 CEST 2025 berlin",  // 12:30 UTC
+		"b: Tue Jun 10 08:30:00 EDT 2025 new york", // 12:30 UTC
+		"a: Tue Jun 10 14:30:00 PDT 2025 seattle",  // 21:30 UTC
+	})
+}
@@ -0,0 +1,81 @@
+package logmerge
+
+import "time"
+
+// Parser finds the timestamp of a log line by other means than a Pattern,
+// e.g. for binary-prefixed or framed lines. Parse returns the timestamp and
+// the rest of the line without it, or an error if the line has no timestamp.
+// A timestamp with year 0 gets its year inferred like a syslog timestamp.
+//
+// If rest is line with one contiguous part removed, that part becomes
+// Line.RawTimestamp, so that Line.OriginalLine gives back line. Parse is
+// called concurrently for different inputs.
+type Parser interface {
+	Parse(line string) (timestamp time.Time, rest string, err error)
+}
+
+// ParserFunc adapts a function to a Parser.
+type ParserFunc func(line string) (time.Time, string, error)
+
+func (f ParserFunc) Parse(line string) (time.Time, string, error) {
+	return f(line)
+}
+
+// PatternParser is a Parser trying Patterns like Merge does: the earliest
+// match in the line wins, the longest one among those at the same position.
+// Timestamps without zone are taken to be in Location, default UTC. Unlike
+// Merge it has no per-input state, so year-less timestamps keep year 0.
+type PatternParser struct {
+	Patterns []Pattern
+	Location *time.Location
+}
+
+// DefaultPatterns returns a copy of the built-in patterns, e.g. for a
+// PatternParser.
+func DefaultPatterns() []Pattern {
+	return append([]Pattern(nil), timestampPatterns...)
+}
+
+// ActivePatterns returns the patterns Merge tries with opts, in their order:
+// Options.Patterns, then the built-in ones as adapted to Options.DateOrder.
+// Options.Parsers are tried before all of them.
+func ActivePatterns(opts Options) ([]Pattern, error) {
+	m, err := newMerger(nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	return m.patterns, nil
+}
+
+func (p PatternParser) Parse(line string) (time.Time, string, error) {
+	index, loc, err := bestMatch(p.Patterns, line)
+	if err != nil {
+		return time.Time{}, line, err
+	}
+	location := p.Location
+	if location == nil {
+		location = time.UTC
+	}
+	timestamp, err := parseTimestamp(p.Patterns[index].Layout, line[loc[0]:loc[1]], location, nil)
+	if err != nil {
+		return time.Time{}, line, NoTimestampError
+	}
+	return timestamp, line[:loc[0]] + line[loc[1]:], nil
+}
+
+// parserLine returns the Line of a timestamp found by a Parser, see Parser.
+func parserLine(line string, timestamp time.Time, rest string) Line {
+	parsed := Line{Timestamp: timestamp, RestOfLine: rest}
+	if len(rest) > len(line) {
+		return parsed
+	}
+	offset := 0
+	for offset < len(rest) && rest[offset] == line[offset] {
+		offset++
+	}
+	removed := len(line) - len(rest)
+	if line[offset+removed:] == rest[offset:] {
+		parsed.RawOffset, parsed.RawTimestamp = offset, line[offset:offset+removed]
+	}
+	return parsed
+}
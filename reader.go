@@ -0,0 +1,200 @@
+package logmerge
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// readAhead is how many lines a reader may parse ahead of the merge.
+const readAhead = 64
+
+// readResult is a line read by a reader, or the error that read it instead.
+type readResult struct {
+	line Line
+	err  error
+}
+
+// reader reads and parses the lines of a single input in its own goroutine,
+// so that reading, decompressing and parsing the inputs overlaps with the
+// merge. It holds all per-input state of the parsing.
+type reader struct {
+	m        *merger
+	index    int
+	scanner  *bufio.Scanner
+	location *time.Location
+	recent   []int      // indexes of the patterns that last matched, the latest first
+	year     *yearState // nil until needed, unless the modification time is known
+
+	// with Multiline, the line read after an entry's continuation lines
+	lookahead    *Line
+	lookaheadErr error
+
+	mu    sync.Mutex // guards stats, which the merge reads when done
+	stats FileStats
+}
+
+func (m *merger) newReader(i int, r io.Reader) *reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(skipBOM(scanLines))
+	scanner.Buffer(make([]byte, 0, min(64*1024, m.opts.MaxLineLength)), m.opts.MaxLineLength)
+	rd := &reader{m: m, index: i, scanner: scanner, location: m.locations[i]}
+	if m.opts.ModTimes != nil && !m.opts.ModTimes[i].IsZero() {
+		rd.year = &yearState{reference: m.opts.ModTimes[i]}
+	}
+	return rd
+}
+
+// utf8BOM is the byte order mark some Windows programs start UTF-8 files with.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// skipBOM wraps split to drop a UTF-8 byte order mark at the start of the
+// input, which would otherwise hide the timestamp of the first line.
+func skipBOM(split bufio.SplitFunc) bufio.SplitFunc {
+	first := true
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if first {
+			if !atEOF && len(data) < len(utf8BOM) && bytes.HasPrefix(utf8BOM, data) {
+				return 0, nil, nil
+			}
+			first = false
+			if bytes.HasPrefix(data, utf8BOM) {
+				return len(utf8BOM), nil, nil
+			}
+		}
+		return split(data, atEOF)
+	}
+}
+
+// scanLines is a bufio.SplitFunc like bufio.ScanLines, that also ends lines
+// at a lone \r, as in old Mac files. \r\n is a single line end.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+		// a \n may follow in the next read
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// fileStats returns a copy of the stats collected so far.
+func (r *reader) fileStats() FileStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// run sends the lines of the input on out until its end, a read error or the
+// cancellation of ctx, and closes out. Lines without timestamp are sent with
+// NoTimestampError.
+func (r *reader) run(ctx context.Context, out chan<- readResult) {
+	defer close(out)
+	line, err := r.readFirst()
+	for {
+		select {
+		case out <- readResult{line, err}:
+		case <-ctx.Done():
+			return
+		}
+		if err != nil && !errors.Is(err, NoTimestampError) {
+			return
+		}
+		line, err = r.readNext()
+	}
+}
+
+// skipAll reads the input to its end, only collecting stats, and returns
+// the error that ended it, EndOfFileError at its end.
+func (r *reader) skipAll(ctx context.Context) error {
+	_, err := r.readFirst()
+	for err == nil || errors.Is(err, NoTimestampError) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		_, err = r.readNext()
+	}
+	return err
+}
+
+// readFirst reads the first line with timestamp, skipping the preamble
+// before it, or prepending it with Preamble. With RequireTimestamps and
+// SkipBinary, it gives up on inputs that do not look like logs.
+func (r *reader) readFirst() (Line, error) {
+	m := r.m
+	var preamble []string
+	line, err := r.readNext()
+	for errors.Is(err, NoTimestampError) {
+		if m.opts.SkipBinary && strings.IndexByte(line.RestOfLine, 0) >= 0 {
+			return Line{}, BinaryFileError
+		}
+		preamble = append(preamble, line.RestOfLine)
+		if m.opts.RequireTimestamps > 0 && len(preamble) >= m.opts.RequireTimestamps {
+			return Line{}, fmt.Errorf("%w in the first %d lines", NoTimestampsFoundError, len(preamble))
+		}
+		line, err = r.readNext()
+	}
+	if m.opts.RequireTimestamps > 0 && errors.Is(err, EndOfFileError) && len(preamble) > 0 {
+		return Line{}, fmt.Errorf("%w in %d lines", NoTimestampsFoundError, len(preamble))
+	}
+	if m.opts.SkipBinary && err == nil && strings.IndexByte(line.OriginalLine(), 0) >= 0 {
+		return Line{}, BinaryFileError
+	}
+	if len(preamble) > 0 && err == nil {
+		if m.opts.Preamble {
+			prefix := strings.Join(preamble, "\n") + "\n"
+			line.RestOfLine = prefix + line.RestOfLine
+			line.RawOffset += len(prefix)
+		} else if m.opts.Verbose {
+			m.logWarn(r.index, "skipped lines before the first timestamp", "lines", len(preamble))
+		}
+	}
+	return line, err
+}
+
+// readNext reads the next line. With Multiline, the following lines without
+// timestamp are appended to a timestamped line.
+func (r *reader) readNext() (Line, error) {
+	var line Line
+	var err error
+	if r.lookahead != nil {
+		line, err = *r.lookahead, r.lookaheadErr
+		r.lookahead = nil
+	} else {
+		line, err = r.readNextTimestamp()
+	}
+	line.Filename = r.m.name(r.index)
+	if !r.m.opts.Multiline || err != nil {
+		return line, err
+	}
+	for {
+		next, err := r.readNextTimestamp()
+		if !errors.Is(err, NoTimestampError) {
+			r.lookahead, r.lookaheadErr = &next, err
+			return line, nil
+		}
+		line.RestOfLine += "\n" + next.RestOfLine
+	}
+}
@@ -0,0 +1,104 @@
+package logmerge
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// scan splits input with a split function of newSplit, also when read a byte
+// at a time.
+func scan(t *testing.T, newSplit func() bufio.SplitFunc, input string) []string {
+	t.Helper()
+	var lines []string
+	for _, oneByte := range []bool{false, true} {
+		var got []string
+		r := strings.NewReader(input)
+		scanner := bufio.NewScanner(r)
+		if oneByte {
+			scanner = bufio.NewScanner(iotest.OneByteReader(r))
+		}
+		scanner.Split(newSplit())
+		for scanner.Scan() {
+			got = append(got, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if oneByte && strings.Join(got, "\n") != strings.Join(lines, "\n") {
+			t.Errorf("%q: got %q a byte at a time, %q at once", input, got, lines)
+		}
+		lines = got
+	}
+	return lines
+}
+
+func TestScanLines(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"", nil},
+		{"a\nb\n", []string{"a", "b"}},
+		{"a\nb", []string{"a", "b"}},
+		{"a\r\nb\r\n", []string{"a", "b"}},
+		{"a\rb\r", []string{"a", "b"}},
+		{"a\rb", []string{"a", "b"}},
+		{"a\r\nb\rc\nd", []string{"a", "b", "c", "d"}},
+		{"a\r\r\nb", []string{"a", "", "b"}},
+		{"a\n\r\nb", []string{"a", "", "b"}},
+		{"a\n\nb\r\rc", []string{"a", "", "b", "", "c"}},
+		{"\r", []string{""}},
+	}
+	for _, tt := range tests {
+		if got := scan(t, func() bufio.SplitFunc { return scanLines }, tt.input); strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestMergeLineEnds(t *testing.T) {
+	got := merge(t, Options{},
+		"2025-06-10 14:30:00 windows\r\n2025-06-10 14:30:02 windows\r\n",
+		"2025-06-10 14:30:01 mac\r2025-06-10 14:30:03 mac\r")
+	checkLines(t, got, []string{
+		"a: 2025-06-10 14:30:00 windows",
+		"b: 2025-06-10 14:30:01 mac",
+		"a: 2025-06-10 14:30:02 windows",
+		"b: 2025-06-10 14:30:03 mac",
+	})
+}
+
+func TestSkipBOM(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"", nil},
+		{"\ufeff", nil},
+		{"\ufeffa\nb\n", []string{"a", "b"}},
+		{"\ufeff\ufeffa\n", []string{"\ufeffa"}},
+		{"a\n\ufeffb\n", []string{"a", "\ufeffb"}},
+		// not a whole BOM
+		{"\xef\xbb", []string{"\xef\xbb"}},
+		{"\xef\xbba\n", []string{"\xef\xbba"}},
+	}
+	for _, tt := range tests {
+		got := scan(t, func() bufio.SplitFunc { return skipBOM(scanLines) }, tt.input)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestMergeBOM(t *testing.T) {
+	got := merge(t, Options{},
+		"\ufeff2025-06-10 14:30:00 bom\n2025-06-10 14:30:02 bom\n",
+		"2025-06-10 14:30:01 plain\n")
+	checkLines(t, got, []string{
+		"a: 2025-06-10 14:30:00 bom",
+		"b: 2025-06-10 14:30:01 plain",
+		"a: 2025-06-10 14:30:02 bom",
+	})
+}